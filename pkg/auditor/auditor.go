@@ -29,12 +29,15 @@ type RegistryEntry struct {
 	Timestamp   string
 	Offset      int64
 	LastUpdated time.Time
+	Fingerprint string `json:",omitempty"`
+	Completed   bool   `json:",omitempty"`
 }
 
 // An Auditor handles messages successfully submitted to the intake
 type Auditor struct {
 	inputChan     chan message.Message
 	registry      map[string]*RegistryEntry
+	fingerprints  map[string]string
 	registryMutex *sync.Mutex
 	registryPath  string
 
@@ -50,6 +53,7 @@ func New(inputChan chan message.Message) *Auditor {
 	return &Auditor{
 		inputChan:     inputChan,
 		registryPath:  filepath.Join(config.LogsAgent.GetString("run_path"), "registry.json"),
+		fingerprints:  make(map[string]string),
 		registryMutex: &sync.Mutex{},
 
 		flushPeriod:   defaultFlushPeriod,
@@ -61,6 +65,7 @@ func New(inputChan chan message.Message) *Auditor {
 // Start starts the Auditor
 func (a *Auditor) Start() {
 	a.registry = a.recoverRegistry(a.registryPath)
+	a.fingerprints = indexFingerprints(a.registry)
 	a.cleanupRegistry(a.registry)
 	go a.run()
 	go a.flushRegistryPediodically()
@@ -99,22 +104,88 @@ func (a *Auditor) run() {
 		// This is useful for origins that don't have offsets (networks), or when we
 		// specially want to avoid storing the offset
 		if msg.GetOrigin().Identifier != "" {
-			a.updateRegistry(msg.GetOrigin().Identifier, msg.GetOrigin().Offset, msg.GetOrigin().Timestamp)
+			a.updateRegistry(msg.GetOrigin().Identifier, msg.GetOrigin().Offset, msg.GetOrigin().Timestamp, msg.GetOrigin().Fingerprint, msg.GetOrigin().Completed)
 		}
 	}
 }
 
 // updateRegistry updates the offset of identifier in the auditor's registry
-func (a *Auditor) updateRegistry(identifier string, offset int64, timestamp string) {
+func (a *Auditor) updateRegistry(identifier string, offset int64, timestamp string, fingerprint string, completed bool) {
 	a.registryMutex.Lock()
 	defer a.registryMutex.Unlock()
+	if entry, ok := a.registry[identifier]; ok && entry.Fingerprint != fingerprint {
+		a.unindexFingerprint(identifier)
+	}
 	a.registry[identifier] = &RegistryEntry{
 		LastUpdated: time.Now().UTC(),
 		Offset:      offset,
 		Timestamp:   timestamp,
+		Fingerprint: fingerprint,
+		Completed:   completed,
+	}
+	if fingerprint != "" {
+		// the entry just updated is the most recent one with its fingerprint
+		a.fingerprints[fingerprint] = identifier
+	}
+}
+
+// unindexFingerprint removes the entry of identifier from the fingerprint index,
+// its fingerprint then identifies the most recent other entry having it, if any
+func (a *Auditor) unindexFingerprint(identifier string) {
+	entry, ok := a.registry[identifier]
+	if !ok || a.fingerprints[entry.Fingerprint] != identifier {
+		return
+	}
+	delete(a.fingerprints, entry.Fingerprint)
+	var lastUpdated time.Time
+	for id, other := range a.registry {
+		if id != identifier && other.Fingerprint == entry.Fingerprint && other.LastUpdated.After(lastUpdated) {
+			a.fingerprints[entry.Fingerprint] = id
+			lastUpdated = other.LastUpdated
+		}
+	}
+}
+
+// indexFingerprints returns the identifier of the most recent entry of registry for each fingerprint
+func indexFingerprints(registry map[string]*RegistryEntry) map[string]string {
+	fingerprints := make(map[string]string)
+	for identifier, entry := range registry {
+		if entry.Fingerprint == "" {
+			continue
+		}
+		if indexed, ok := fingerprints[entry.Fingerprint]; ok && !entry.LastUpdated.After(registry[indexed].LastUpdated) {
+			continue
+		}
+		fingerprints[entry.Fingerprint] = identifier
+	}
+	return fingerprints
+}
+
+// RemoveEntry removes the entry of identifier from the registry,
+// for sources that don't exist anymore
+func (a *Auditor) RemoveEntry(identifier string) {
+	a.registryMutex.Lock()
+	defer a.registryMutex.Unlock()
+	a.unindexFingerprint(identifier)
+	delete(a.registry, identifier)
+}
+
+// RefreshEntry postpones the expiration of the entry of identifier,
+// for sources that still exist but are not read anymore
+func (a *Auditor) RefreshEntry(identifier string) {
+	a.registryMutex.Lock()
+	defer a.registryMutex.Unlock()
+	if entry, ok := a.registry[identifier]; ok {
+		entry.LastUpdated = time.Now().UTC()
 	}
 }
 
+// CompleteEntry records that the source of identifier was read entirely until offset,
+// for sources whose content was already sent under another identifier
+func (a *Auditor) CompleteEntry(identifier string, offset int64, fingerprint string) {
+	a.updateRegistry(identifier, offset, "", fingerprint, true)
+}
+
 // recoverRegistry rebuilds the registry from the state file found at path
 func (a *Auditor) recoverRegistry(path string) map[string]*RegistryEntry {
 	mr, err := ioutil.ReadFile(path)
@@ -171,6 +242,35 @@ func (a *Auditor) GetLastCommitedTimestamp(identifier string) string {
 	return entry.Timestamp
 }
 
+// GetLastCommitedFingerprint returns the fingerprint of the content
+// last commited for a given identifier
+func (a *Auditor) GetLastCommitedFingerprint(identifier string) string {
+	r := a.readOnlyRegistryCopy(a.registry)
+	entry, ok := r[identifier]
+	if !ok {
+		return ""
+	}
+	return entry.Fingerprint
+}
+
+// IsCompleted returns true if the source of identifier was read entirely
+func (a *Auditor) IsCompleted(identifier string) bool {
+	r := a.readOnlyRegistryCopy(a.registry)
+	entry, ok := r[identifier]
+	return ok && entry.Completed
+}
+
+// GetIdentifierForFingerprint returns the identifier most recently commited
+// with a given fingerprint, or "" if the fingerprint is unknown
+func (a *Auditor) GetIdentifierForFingerprint(fingerprint string) string {
+	if fingerprint == "" {
+		return ""
+	}
+	a.registryMutex.Lock()
+	defer a.registryMutex.Unlock()
+	return a.fingerprints[fingerprint]
+}
+
 // cleanupRegistry removes expired entries from the registry
 func (a *Auditor) cleanupRegistry(registry map[string]*RegistryEntry) {
 	expireBefore := time.Now().UTC().Add(-a.entryTTL)
@@ -178,6 +278,7 @@ func (a *Auditor) cleanupRegistry(registry map[string]*RegistryEntry) {
 	defer a.registryMutex.Unlock()
 	for path, entry := range registry {
 		if entry.LastUpdated.Before(expireBefore) {
+			a.unindexFingerprint(path)
 			delete(registry, path)
 		}
 	}
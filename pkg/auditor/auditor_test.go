@@ -52,14 +52,14 @@ func (suite *AuditorTestSuite) TearDownTest() {
 func (suite *AuditorTestSuite) TestAuditorUpdatesRegistry() {
 	suite.a.registry = make(map[string]*RegistryEntry)
 	suite.Equal(0, len(suite.a.registry))
-	suite.a.updateRegistry(suite.source.Path, 42, "")
+	suite.a.updateRegistry(suite.source.Path, 42, "", "", false)
 	suite.Equal(1, len(suite.a.registry))
 	suite.Equal(int64(42), suite.a.registry[suite.source.Path].Offset)
 	suite.Equal("", suite.a.registry[suite.source.Path].Timestamp)
-	suite.a.updateRegistry(suite.source.Path, 43, "")
+	suite.a.updateRegistry(suite.source.Path, 43, "", "", false)
 	suite.Equal(int64(43), suite.a.registry[suite.source.Path].Offset)
 	ts := time.Now().UTC().Format("2006-01-02T15:04:05.000000")
-	suite.a.updateRegistry("containerid", 0, ts)
+	suite.a.updateRegistry("containerid", 0, ts, "", false)
 	suite.Equal(ts, suite.a.registry["containerid"].Timestamp)
 }
 
@@ -106,6 +106,96 @@ func (suite *AuditorTestSuite) TestAuditorRecoversRegistryForTimestamp() {
 	suite.Equal("", suite.a.GetLastCommitedTimestamp(othersource.Path))
 }
 
+func (suite *AuditorTestSuite) TestAuditorRecoversRegistryForFingerprint() {
+	suite.a.registry = make(map[string]*RegistryEntry)
+	suite.a.updateRegistry(suite.source.Path, 42, "", "abc", false)
+	suite.Equal("abc", suite.a.GetLastCommitedFingerprint(suite.source.Path))
+	suite.Equal("", suite.a.GetLastCommitedFingerprint("anotherpath"))
+
+	suite.Equal(suite.source.Path, suite.a.GetIdentifierForFingerprint("abc"))
+	suite.Equal("", suite.a.GetIdentifierForFingerprint("def"))
+	suite.Equal("", suite.a.GetIdentifierForFingerprint(""))
+
+	// the most recent entry wins
+	suite.a.updateRegistry("anotherpath", 43, "", "abc", false)
+	suite.Equal("anotherpath", suite.a.GetIdentifierForFingerprint("abc"))
+
+	// an entry removed or updated with another fingerprint is not found anymore
+	suite.a.updateRegistry("anotherpath", 44, "", "def", false)
+	suite.Equal(suite.source.Path, suite.a.GetIdentifierForFingerprint("abc"))
+	suite.Equal("anotherpath", suite.a.GetIdentifierForFingerprint("def"))
+	suite.a.RemoveEntry("anotherpath")
+	suite.Equal("", suite.a.GetIdentifierForFingerprint("def"))
+}
+
+func (suite *AuditorTestSuite) TestAuditorIndexesRecoveredFingerprints() {
+	registry := map[string]*RegistryEntry{
+		"file:/var/log/a.log":   &RegistryEntry{LastUpdated: time.Now().UTC(), Fingerprint: "abc"},
+		"file:/var/log/a.log.1": &RegistryEntry{LastUpdated: time.Now().UTC().Add(-time.Hour), Fingerprint: "abc"},
+		"file:/var/log/b.log":   &RegistryEntry{LastUpdated: time.Now().UTC()},
+	}
+	suite.Equal(map[string]string{"abc": "file:/var/log/a.log"}, indexFingerprints(registry))
+}
+
+func (suite *AuditorTestSuite) TestAuditorFlushesFingerprint() {
+	suite.a.registry = make(map[string]*RegistryEntry)
+	suite.a.registry[suite.source.Path] = &RegistryEntry{
+		LastUpdated: time.Date(2006, time.January, 12, 1, 1, 1, 1, time.UTC),
+		Offset:      42,
+		Fingerprint: "abc",
+	}
+	suite.a.flushRegistry(suite.a.registry, suite.testPath)
+	r, err := ioutil.ReadFile(suite.testPath)
+	suite.Nil(err)
+	suite.Equal("{\"Version\":1,\"Registry\":{\"testpath\":{\"Timestamp\":\"\",\"Offset\":42,\"LastUpdated\":\"2006-01-12T01:01:01.000000001Z\",\"Fingerprint\":\"abc\"}}}", string(r))
+
+	suite.a.registry = suite.a.recoverRegistry(suite.testPath)
+	suite.Equal("abc", suite.a.registry[suite.source.Path].Fingerprint)
+}
+
+func (suite *AuditorTestSuite) TestAuditorRecoversCompletion() {
+	suite.a.registry = make(map[string]*RegistryEntry)
+	suite.a.updateRegistry(suite.source.Path, 42, "", "abc", false)
+	suite.False(suite.a.IsCompleted(suite.source.Path))
+	suite.a.updateRegistry(suite.source.Path, 84, "", "abc", true)
+	suite.True(suite.a.IsCompleted(suite.source.Path))
+	suite.False(suite.a.IsCompleted("anotherpath"))
+}
+
+func (suite *AuditorTestSuite) TestAuditorCompletesEntry() {
+	suite.a.registry = make(map[string]*RegistryEntry)
+	suite.a.CompleteEntry(suite.source.Path, 42, "abc")
+	suite.True(suite.a.IsCompleted(suite.source.Path))
+	suite.Equal(suite.source.Path, suite.a.GetIdentifierForFingerprint("abc"))
+	offset, _ := suite.a.GetLastCommitedOffset(suite.source.Path)
+	suite.Equal(int64(42), offset)
+}
+
+func (suite *AuditorTestSuite) TestAuditorRemovesEntry() {
+	suite.a.registry = make(map[string]*RegistryEntry)
+	suite.a.updateRegistry(suite.source.Path, 42, "", "", false)
+	suite.a.updateRegistry("anotherpath", 43, "", "", false)
+	suite.a.RemoveEntry(suite.source.Path)
+	suite.Equal(1, len(suite.a.registry))
+	suite.Nil(suite.a.registry[suite.source.Path])
+	offset, whence := suite.a.GetLastCommitedOffset(suite.source.Path)
+	suite.Equal(int64(0), offset)
+	suite.Equal(os.SEEK_END, whence)
+}
+
+func (suite *AuditorTestSuite) TestAuditorRefreshesEntry() {
+	suite.a.registry = make(map[string]*RegistryEntry)
+	suite.a.registry[suite.source.Path] = &RegistryEntry{
+		LastUpdated: time.Date(2006, time.January, 12, 1, 1, 1, 1, time.UTC),
+		Offset:      42,
+	}
+	suite.a.RefreshEntry(suite.source.Path)
+	suite.a.RefreshEntry("anotherpath")
+	suite.a.cleanupRegistry(suite.a.registry)
+	suite.Equal(1, len(suite.a.registry))
+	suite.Equal(int64(42), suite.a.registry[suite.source.Path].Offset)
+}
+
 func (suite *AuditorTestSuite) TestAuditorCleansupRegistry() {
 	suite.a.registry = make(map[string]*RegistryEntry)
 	suite.a.registry[suite.source.Path] = &RegistryEntry{
@@ -28,6 +28,10 @@ func buildMainConfig(config *viper.Viper, ddconfigPath, ddconfdPath string) erro
 
 	config.SetConfigFile(ddconfigPath)
 
+	// the defaults of the settings only known by the logs agent
+	config.SetDefault("open_files_limit", 0)
+	config.SetDefault("inactive_file_timeout", 300)
+
 	err := config.ReadInConfig()
 	if err != nil {
 		return err
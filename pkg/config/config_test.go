@@ -29,6 +29,8 @@ func TestBuildConfigWithCompleteFile(t *testing.T) {
 	assert.Equal(t, 10516, testConfig.GetInt("log_dd_port"))
 	assert.Equal(t, true, testConfig.GetBool("skip_ssl_validation"))
 	assert.Equal(t, true, testConfig.GetBool("log_enabled"))
+	assert.Equal(t, 0, testConfig.GetInt("open_files_limit"))
+	assert.Equal(t, 300, testConfig.GetInt("inactive_file_timeout"))
 }
 
 func TestDDConfigDefaultValues(t *testing.T) {
@@ -72,4 +74,9 @@ func TestComputeConfigWithMisconfiguredFile(t *testing.T) {
 	ddconfdPath = filepath.Join(testsPath, "misconfigured_5", "conf.d")
 	err = buildMainConfig(testConfig, ddconfigPath, ddconfdPath)
 	assert.NotNil(t, err)
+
+	ddconfigPath = filepath.Join(testsPath, "misconfigured_6", "datadog.yaml")
+	ddconfdPath = filepath.Join(testsPath, "misconfigured_6", "conf.d")
+	err = buildMainConfig(testConfig, ddconfigPath, ddconfdPath)
+	assert.NotNil(t, err)
 }
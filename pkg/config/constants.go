@@ -5,6 +5,10 @@
 
 package config
 
+import (
+	"strings"
+)
+
 // Technical constants
 
 const (
@@ -19,6 +23,37 @@ const (
 )
 
 var (
-	SEV_INFO  = []byte("<46>")
-	SEV_ERROR = []byte("<43>")
+	SEV_EMERGENCY = []byte("<40>")
+	SEV_ALERT     = []byte("<41>")
+	SEV_CRITICAL  = []byte("<42>")
+	SEV_ERROR     = []byte("<43>")
+	SEV_WARNING   = []byte("<44>")
+	SEV_NOTICE    = []byte("<45>")
+	SEV_INFO      = []byte("<46>")
+	SEV_DEBUG     = []byte("<47>")
 )
+
+// severities maps the usual level names to syslog severities
+var severities = map[string][]byte{
+	"emerg":       SEV_EMERGENCY,
+	"emergency":   SEV_EMERGENCY,
+	"panic":       SEV_EMERGENCY,
+	"alert":       SEV_ALERT,
+	"crit":        SEV_CRITICAL,
+	"critical":    SEV_CRITICAL,
+	"fatal":       SEV_CRITICAL,
+	"err":         SEV_ERROR,
+	"error":       SEV_ERROR,
+	"warn":        SEV_WARNING,
+	"warning":     SEV_WARNING,
+	"notice":      SEV_NOTICE,
+	"info":        SEV_INFO,
+	"information": SEV_INFO,
+	"debug":       SEV_DEBUG,
+	"trace":       SEV_DEBUG,
+}
+
+// SeverityFromLevel returns the syslog severity of a level name, or nil if it's unknown
+func SeverityFromLevel(level string) []byte {
+	return severities[strings.ToLower(strings.TrimSpace(level))]
+}
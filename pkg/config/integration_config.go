@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -21,8 +22,87 @@ const (
 	FILE_TYPE        = "file"
 	DOCKER_TYPE      = "docker"
 	EXCLUDE_AT_MATCH = "exclude_at_match"
+	INCLUDE_AT_MATCH = "include_at_match"
 	MASK_SEQUENCES   = "mask_sequences"
 	MULTILINE        = "multi_line"
+	EXTRACT          = "extract"
+	DEDUPE           = "dedupe"
+	SEVERITY         = "severity"
+	TIMESTAMP        = "timestamp"
+)
+
+// Layouts of the timestamps captured by a timestamp rule, any other value is a go layout
+const (
+	TIMESTAMP_LAYOUT_UNIX       = "unix"       // epoch in seconds
+	TIMESTAMP_LAYOUT_UNIX_MS    = "unix_ms"    // epoch in milliseconds
+	TIMESTAMP_LAYOUT_RFC3339    = "rfc3339"    // 2017-10-16T12:00:00.000Z
+	TIMESTAMP_LAYOUT_COMMON_LOG = "common_log" // 16/Oct/2017:12:00:00 +0200
+	TIMESTAMP_LAYOUT_SYSLOG     = "syslog"     // Oct 16 12:00:00, in the current year
+)
+
+// Timestamps of the messages of the sources with timestamp rules when no rule matches:
+// the time of the source, like the time docker received the message, or the time the agent
+// read it, or the timestamp of the previous message of the source
+const (
+	TIMESTAMP_FALLBACK_INGESTION_TIME = "ingestion_time"
+	TIMESTAMP_FALLBACK_PREVIOUS       = "previous"
+)
+
+// Destinations of the fields captured by an extract rule
+const (
+	EXTRACT_TO_STRUCTURED_DATA = "structured_data"
+	EXTRACT_TO_TAGS            = "tags"
+)
+
+// Grouping of the lines matched by the pattern of a multi_line rule, or not matched with negate,
+// as in Filebeat: after appends them to the previous line, before prepends them to the next line.
+// Without match, the pattern matches the first line of the logs
+const (
+	MULTILINE_MATCH_AFTER  = "after"
+	MULTILINE_MATCH_BEFORE = "before"
+)
+
+// Start positions of the sources whose logs were never collected
+const (
+	START_POSITION_BEGINNING    = "beginning"
+	START_POSITION_END          = "end"
+	START_POSITION_LAST_N_BYTES = "last_n_bytes"
+)
+
+// Encodings of the files to tail
+const (
+	ENCODING_UTF8    = "utf-8"
+	ENCODING_UTF16LE = "utf-16-le"
+	ENCODING_UTF16BE = "utf-16-be"
+	ENCODING_LATIN1  = "latin-1"
+)
+
+// Formats of the content of the logs
+const (
+	LOG_FORMAT_JSON   = "json"
+	LOG_FORMAT_CRI    = "cri"
+	LOG_FORMAT_DOCKER = "docker"
+	LOG_FORMAT_SYSLOG = "syslog"
+)
+
+// Delimiters of the lines, any other value is used as is
+const (
+	DELIMITER_NEWLINE = "newline"
+	DELIMITER_NUL     = "nul"
+)
+
+// Framings of the messages received by tcp sources,
+// messages are delimited by default
+const (
+	FRAMING_OCTET_COUNTING = "octet_counting"
+	FRAMING_AUTO           = "auto"
+)
+
+// Policies applied to the messages longer than the maximum message size
+const (
+	TRUNCATION_POLICY_TRUNCATE = "truncate"
+	TRUNCATION_POLICY_DROP     = "drop"
+	TRUNCATION_POLICY_SPLIT    = "split"
 )
 
 const INTEGRATION_CONFIG_EXTENTION = ".yaml"
@@ -36,6 +116,26 @@ type LogsProcessingRule struct {
 	Pattern                 string
 	Reg                     *regexp.Regexp
 	ReplacePlaceholderBytes []byte
+
+	// Multi-line
+	EndPattern   string `mapstructure:"end_pattern"` // matches the last line of the logs
+	EndReg       *regexp.Regexp
+	Negate       bool   // with match, the lines not matching pattern are grouped
+	Match        string // after or before, the lines matching pattern are grouped with the previous or next line
+	MaxLines     int    `mapstructure:"max_lines"`     // 0 means no limit
+	FlushTimeout int    `mapstructure:"flush_timeout"` // in seconds, 0 means the default timeout
+
+	// Extract
+	ExtractTo string `mapstructure:"extract_to"` // structured_data (default) or tags
+
+	// Dedupe
+	Window int // in seconds, identical lines within the window are collapsed, 0 collapses consecutive identical lines
+
+	// Severity
+	Level string // level name, like error or warning, of the lines matching pattern
+
+	// Timestamp
+	Layout string // layout of the timestamp captured by pattern, in its timestamp group or first group
 }
 
 // IntegrationConfigLogSource represents a log source config, which can be for instance
@@ -43,11 +143,34 @@ type LogsProcessingRule struct {
 type IntegrationConfigLogSource struct {
 	Type string
 
-	Port int    // Network
-	Path string // File
+	Port           int      // Network
+	Framing        string   // Tcp, octet_counting reads `<length> <message>` frames, auto detects it on the first frame
+	Path           string   // File, can contain wildcards, `**` matches any number of directories
+	ReadCompressed bool     `mapstructure:"read_compressed"` // File, reads .gz and .bz2 files once
+	Encoding       string   // File, transcoded to UTF-8, defaults to utf-8
+	ExcludePaths   []string `mapstructure:"exclude_paths"` // File, patterns of the files and directories not to tail
+
+	Image        string // Docker
+	Label        string // Docker
+	ReadFromDisk bool   `mapstructure:"read_from_disk"` // Docker, tails the json-file logs of the containers instead of using the API
+
+	LogFormat     string `mapstructure:"log_format"`      // json parses one object per line into fields, cri and docker parse container runtime logs, syslog parses RFC3164 and RFC5424 messages
+	AutoMultiLine bool   `mapstructure:"auto_multi_line"` // groups lines following the format detected on the first lines
+	Delimiter     string // newline (default, also strips '\r'), nul or any byte sequence ending the lines
+
+	MaxMessageSize   int    `mapstructure:"max_message_size"`  // in bytes, defaults to the global max_message_size
+	TruncationPolicy string `mapstructure:"truncation_policy"` // truncate, drop or split longer messages, defaults to the global truncation_policy
 
-	Image string // Docker
-	Label string // Docker
+	RateLimit      float64 `mapstructure:"rate_limit"`       // messages per second, 0 means no limit
+	RateLimitBurst int     `mapstructure:"rate_limit_burst"` // messages sent above rate_limit after a quiet period, defaults to rate_limit
+	SampleRate     float64 `mapstructure:"sample_rate"`      // ratio of the messages sent, 0 and 1 send them all
+
+	DetectSeverity bool `mapstructure:"detect_severity"` // looks for a level like ERROR or level=warn in the messages without severity
+
+	TimestampFallback string `mapstructure:"timestamp_fallback"` // ingestion_time (default) or previous, when no timestamp rule matches
+
+	StartPosition string `mapstructure:"start_position"` // File and Docker, where to start when logs were never collected
+	LastNBytes    int64  `mapstructure:"last_n_bytes"`   // File, number of bytes to read back with last_n_bytes
 
 	Service         string
 	Logset          string
@@ -60,7 +183,8 @@ type IntegrationConfigLogSource struct {
 
 // IntegrationConfig represents a dd agent config, which includes infra and logs parts
 type IntegrationConfig struct {
-	Logs []IntegrationConfigLogSource
+	Logs        []IntegrationConfigLogSource
+	LogPatterns map[string]string `mapstructure:"log_patterns"` // reusable patterns of the rules of all sources, by name
 }
 
 // GetLogsSources returns a list of integration sources
@@ -83,6 +207,10 @@ func buildLogsAgentIntegrationsConfig(config *viper.Viper, ddconfdPath string) e
 	integrationConfigFiles := availableIntegrationConfigs(ddconfdPath)
 	logsSourceConfigs := []*IntegrationConfigLogSource{}
 
+	// the patterns of a file can be used by the rules of the other files
+	integrationConfigs := []IntegrationConfig{}
+	patterns := newPatternLibrary()
+	definedPatterns := make(map[string]bool)
 	for _, file := range integrationConfigFiles {
 		var integrationConfig IntegrationConfig
 		var viperCfg = viper.New()
@@ -95,15 +223,28 @@ func buildLogsAgentIntegrationsConfig(config *viper.Viper, ddconfdPath string) e
 		if err != nil {
 			return err
 		}
+		err = patterns.add(integrationConfig.LogPatterns, definedPatterns)
+		if err != nil {
+			return err
+		}
+		integrationConfigs = append(integrationConfigs, integrationConfig)
+	}
 
+	for _, integrationConfig := range integrationConfigs {
 		for _, logSourceConfigIterator := range integrationConfig.Logs {
 			logSourceConfig := logSourceConfigIterator
-			err = validateSource(logSourceConfig)
+			if logSourceConfig.MaxMessageSize == 0 {
+				logSourceConfig.MaxMessageSize = config.GetInt("max_message_size")
+			}
+			if logSourceConfig.TruncationPolicy == "" {
+				logSourceConfig.TruncationPolicy = config.GetString("truncation_policy")
+			}
+			err := validateSource(logSourceConfig)
 			if err != nil {
 				return err
 			}
 
-			rules, err := validateProcessingRules(logSourceConfig.ProcessingRules)
+			rules, err := validateProcessingRules(logSourceConfig.ProcessingRules, patterns)
 			if err != nil {
 				return err
 			}
@@ -162,6 +303,120 @@ func validateSource(config IntegrationConfigLogSource) error {
 		return fmt.Errorf("A file source must have a path")
 	}
 
+	if config.Type == FILE_TYPE {
+		if _, err := filepath.Match(config.Path, ""); err != nil {
+			return fmt.Errorf("A file source must have a valid path pattern (got %s)", config.Path)
+		}
+	}
+
+	for _, excludePath := range config.ExcludePaths {
+		if config.Type != FILE_TYPE {
+			return fmt.Errorf("A %s source can't exclude paths", config.Type)
+		}
+		if _, err := filepath.Match(excludePath, ""); err != nil || excludePath == "" {
+			return fmt.Errorf("A file source must have valid exclude_paths patterns (got %s)", excludePath)
+		}
+	}
+
+	switch config.StartPosition {
+	case "", START_POSITION_BEGINNING, START_POSITION_END:
+	case START_POSITION_LAST_N_BYTES:
+		if config.Type != FILE_TYPE {
+			return fmt.Errorf("A %s source can't start at %s", config.Type, config.StartPosition)
+		}
+		if config.LastNBytes <= 0 {
+			return fmt.Errorf("A file source starting at %s must have a positive last_n_bytes", config.StartPosition)
+		}
+	default:
+		return fmt.Errorf("A source must have a valid start_position (got %s)", config.StartPosition)
+	}
+
+	if config.AutoMultiLine {
+		for _, rule := range config.ProcessingRules {
+			if rule.Type == MULTILINE {
+				return fmt.Errorf("A source can't have both auto_multi_line and a %s rule", MULTILINE)
+			}
+		}
+	}
+
+	switch config.LogFormat {
+	case "", LOG_FORMAT_JSON:
+	case LOG_FORMAT_CRI, LOG_FORMAT_DOCKER:
+		if config.Type != FILE_TYPE {
+			return fmt.Errorf("A %s source can't have the %s log_format", config.Type, config.LogFormat)
+		}
+	case LOG_FORMAT_SYSLOG:
+		if config.Type != TCP_TYPE && config.Type != UDP_TYPE {
+			return fmt.Errorf("A %s source can't have the %s log_format", config.Type, config.LogFormat)
+		}
+	default:
+		return fmt.Errorf("A source must have a valid log_format (got %s)", config.LogFormat)
+	}
+
+	if config.ReadFromDisk && config.Type != DOCKER_TYPE {
+		return fmt.Errorf("A %s source can't read container logs from disk", config.Type)
+	}
+
+	switch config.Delimiter {
+	case "", DELIMITER_NEWLINE:
+	default:
+		if config.Type == DOCKER_TYPE {
+			return fmt.Errorf("A %s source can't have a delimiter", config.Type)
+		}
+	}
+
+	switch config.Framing {
+	case "":
+	case FRAMING_OCTET_COUNTING, FRAMING_AUTO:
+		if config.Type != TCP_TYPE {
+			return fmt.Errorf("A %s source can't have the %s framing", config.Type, config.Framing)
+		}
+	default:
+		return fmt.Errorf("A source must have a valid framing (got %s)", config.Framing)
+	}
+
+	if config.MaxMessageSize < 0 {
+		return fmt.Errorf("A source can't have a negative max_message_size (got %d)", config.MaxMessageSize)
+	}
+
+	switch config.TruncationPolicy {
+	case "", TRUNCATION_POLICY_TRUNCATE, TRUNCATION_POLICY_DROP, TRUNCATION_POLICY_SPLIT:
+	default:
+		return fmt.Errorf("A source must have a valid truncation_policy (got %s)", config.TruncationPolicy)
+	}
+
+	if config.RateLimit < 0 {
+		return fmt.Errorf("A source can't have a negative rate_limit (got %v)", config.RateLimit)
+	}
+
+	if config.RateLimitBurst < 0 {
+		return fmt.Errorf("A source can't have a negative rate_limit_burst (got %d)", config.RateLimitBurst)
+	}
+
+	if config.RateLimitBurst > 0 && config.RateLimit == 0 {
+		return fmt.Errorf("A source can't have a rate_limit_burst without rate_limit")
+	}
+
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return fmt.Errorf("A source must have a sample_rate between 0 and 1 (got %v)", config.SampleRate)
+	}
+
+	switch config.TimestampFallback {
+	case "", TIMESTAMP_FALLBACK_INGESTION_TIME, TIMESTAMP_FALLBACK_PREVIOUS:
+	default:
+		return fmt.Errorf("A source must have a valid timestamp_fallback (got %s)", config.TimestampFallback)
+	}
+
+	switch config.Encoding {
+	case "", ENCODING_UTF8:
+	case ENCODING_UTF16LE, ENCODING_UTF16BE, ENCODING_LATIN1:
+		if config.Type != FILE_TYPE {
+			return fmt.Errorf("A %s source can't have an encoding", config.Type)
+		}
+	default:
+		return fmt.Errorf("A source must have a valid encoding (got %s)", config.Encoding)
+	}
+
 	if config.Type == TCP_TYPE && config.Port == 0 {
 		return fmt.Errorf("A tcp source must have a port")
 	}
@@ -173,8 +428,10 @@ func validateSource(config IntegrationConfigLogSource) error {
 	return nil
 }
 
-// validateProcessingRules checks the rules and raises errors if one is misconfigured
-func validateProcessingRules(rules []LogsProcessingRule) ([]LogsProcessingRule, error) {
+// validateProcessingRules checks the rules and raises errors if one is misconfigured,
+// the patterns of extract rules can reference the patterns of the library
+func validateProcessingRules(rules []LogsProcessingRule, patterns patternLibrary) ([]LogsProcessingRule, error) {
+	dedupeRules := 0
 	for i, rule := range rules {
 		if rule.Name == "" {
 			return nil, fmt.Errorf("LogsAgent misconfigured: all log processing rules need a name")
@@ -182,11 +439,105 @@ func validateProcessingRules(rules []LogsProcessingRule) ([]LogsProcessingRule,
 		switch rule.Type {
 		case EXCLUDE_AT_MATCH:
 			rules[i].Reg = regexp.MustCompile(rule.Pattern)
+		case INCLUDE_AT_MATCH:
+			if rule.Pattern == "" {
+				return nil, fmt.Errorf("LogsAgent misconfigured: pattern must be set for log processing rule `%s`", rule.Name)
+			}
+			reg, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("LogsAgent misconfigured: invalid pattern for log processing rule `%s`: %s", rule.Name, err)
+			}
+			rules[i].Reg = reg
 		case MASK_SEQUENCES:
 			rules[i].Reg = regexp.MustCompile(rule.Pattern)
 			rules[i].ReplacePlaceholderBytes = []byte(rule.ReplacePlaceholder)
 		case MULTILINE:
-			rules[i].Reg = regexp.MustCompile("^" + rule.Pattern)
+			if rule.Pattern == "" && rule.EndPattern == "" {
+				return nil, fmt.Errorf("LogsAgent misconfigured: pattern or end_pattern must be set for log processing rule `%s`", rule.Name)
+			}
+			if rule.Pattern != "" {
+				pattern := rule.Pattern
+				if rule.Match == "" {
+					// the pattern matches the start of the first line
+					pattern = "^" + pattern
+				}
+				reg, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("LogsAgent misconfigured: invalid pattern for log processing rule `%s`: %s", rule.Name, err)
+				}
+				rules[i].Reg = reg
+			}
+			if rule.EndPattern != "" {
+				reg, err := regexp.Compile(rule.EndPattern)
+				if err != nil {
+					return nil, fmt.Errorf("LogsAgent misconfigured: invalid end_pattern for log processing rule `%s`: %s", rule.Name, err)
+				}
+				rules[i].EndReg = reg
+			}
+			switch rule.Match {
+			case "", MULTILINE_MATCH_AFTER, MULTILINE_MATCH_BEFORE:
+			default:
+				return nil, fmt.Errorf("LogsAgent misconfigured: match must be %s or %s for log processing rule `%s`", MULTILINE_MATCH_AFTER, MULTILINE_MATCH_BEFORE, rule.Name)
+			}
+			if rule.Negate && rule.Match == "" {
+				return nil, fmt.Errorf("LogsAgent misconfigured: match must be set with negate for log processing rule `%s`", rule.Name)
+			}
+			if rule.MaxLines < 0 {
+				return nil, fmt.Errorf("LogsAgent misconfigured: max_lines can't be negative for log processing rule `%s`", rule.Name)
+			}
+			if rule.FlushTimeout < 0 {
+				return nil, fmt.Errorf("LogsAgent misconfigured: flush_timeout can't be negative for log processing rule `%s`", rule.Name)
+			}
+		case EXTRACT:
+			pattern, err := patterns.expand(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("LogsAgent misconfigured: invalid pattern for log processing rule `%s`: %s", rule.Name, err)
+			}
+			reg, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("LogsAgent misconfigured: invalid pattern for log processing rule `%s`: %s", rule.Name, err)
+			}
+			if !hasNamedGroup(reg) {
+				return nil, fmt.Errorf("LogsAgent misconfigured: pattern must capture named fields for log processing rule `%s`", rule.Name)
+			}
+			rules[i].Reg = reg
+			switch rule.ExtractTo {
+			case "", EXTRACT_TO_STRUCTURED_DATA, EXTRACT_TO_TAGS:
+			default:
+				return nil, fmt.Errorf("LogsAgent misconfigured: extract_to must be %s or %s for log processing rule `%s`", EXTRACT_TO_STRUCTURED_DATA, EXTRACT_TO_TAGS, rule.Name)
+			}
+		case SEVERITY:
+			if rule.Pattern == "" {
+				return nil, fmt.Errorf("LogsAgent misconfigured: pattern must be set for log processing rule `%s`", rule.Name)
+			}
+			reg, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("LogsAgent misconfigured: invalid pattern for log processing rule `%s`: %s", rule.Name, err)
+			}
+			rules[i].Reg = reg
+			if SeverityFromLevel(rule.Level) == nil {
+				return nil, fmt.Errorf("LogsAgent misconfigured: level must be a valid level name for log processing rule `%s` (got %s)", rule.Name, rule.Level)
+			}
+		case TIMESTAMP:
+			if rule.Pattern == "" {
+				return nil, fmt.Errorf("LogsAgent misconfigured: pattern must be set for log processing rule `%s`", rule.Name)
+			}
+			reg, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("LogsAgent misconfigured: invalid pattern for log processing rule `%s`: %s", rule.Name, err)
+			}
+			rules[i].Reg = reg
+			if !isValidTimestampLayout(rule.Layout) {
+				return nil, fmt.Errorf("LogsAgent misconfigured: layout must be a valid timestamp layout for log processing rule `%s` (got %s)", rule.Name, rule.Layout)
+			}
+		case DEDUPE:
+			dedupeRules++
+			if dedupeRules > 1 {
+				return nil, fmt.Errorf("LogsAgent misconfigured: a source can't have several %s rules", DEDUPE)
+			}
+			if rule.Window < 0 {
+				return nil, fmt.Errorf("LogsAgent misconfigured: window can't be negative for log processing rule `%s`", rule.Name)
+			}
 		default:
 			if rule.Type == "" {
 				return nil, fmt.Errorf("LogsAgent misconfigured: type must be set for log processing rule `%s`", rule.Name)
@@ -198,6 +549,30 @@ func validateProcessingRules(rules []LogsProcessingRule) ([]LogsProcessingRule,
 	return rules, nil
 }
 
+// isValidTimestampLayout returns true if layout is a named layout,
+// or a go layout able to parse the times it formats
+func isValidTimestampLayout(layout string) bool {
+	switch layout {
+	case TIMESTAMP_LAYOUT_UNIX, TIMESTAMP_LAYOUT_UNIX_MS, TIMESTAMP_LAYOUT_RFC3339, TIMESTAMP_LAYOUT_COMMON_LOG, TIMESTAMP_LAYOUT_SYSLOG:
+		return true
+	case "":
+		return false
+	}
+	reference := time.Date(2017, time.October, 16, 12, 34, 56, 0, time.UTC)
+	parsed, err := time.Parse(layout, reference.Format(layout))
+	return err == nil && parsed.Year() == reference.Year()
+}
+
+// hasNamedGroup returns true if reg has a named capturing group
+func hasNamedGroup(reg *regexp.Regexp) bool {
+	for _, name := range reg.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // Given a list of tags, BuildTagsPayload generates the bytes array that will be inserted
 // into messages
 func BuildTagsPayload(configTags, source, sourceCategory string) []byte {
@@ -21,6 +21,8 @@ func TestAvailableIntegrationConfigs(t *testing.T) {
 func TestBuildLogsAgentIntegrationsConfigs(t *testing.T) {
 	ddconfdPath := filepath.Join(testsPath, "complete", "conf.d")
 	var testConfig = viper.New()
+	testConfig.Set("max_message_size", 1024)
+	testConfig.Set("truncation_policy", TRUNCATION_POLICY_DROP)
 	buildLogsAgentIntegrationsConfig(testConfig, ddconfdPath)
 
 	rules := getLogsSources(testConfig)
@@ -32,6 +34,10 @@ func TestBuildLogsAgentIntegrationsConfigs(t *testing.T) {
 	assert.Equal(t, "http_access", rules[0].SourceCategory)
 	assert.Equal(t, "", rules[0].Logset)
 	assert.Equal(t, "env:prod", rules[0].Tags)
+	assert.Equal(t, START_POSITION_BEGINNING, rules[0].StartPosition)
+	assert.Equal(t, ENCODING_UTF16LE, rules[0].Encoding)
+	assert.Equal(t, 1024, rules[0].MaxMessageSize)
+	assert.Equal(t, TRUNCATION_POLICY_SPLIT, rules[0].TruncationPolicy)
 	assert.Equal(t, "[dd ddsource=\"nginx\"][dd ddsourcecategory=\"http_access\"][dd ddtags=\"env:prod\"]", string(rules[0].TagsPayload))
 
 	assert.Equal(t, "tcp", rules[1].Type)
@@ -40,9 +46,14 @@ func TestBuildLogsAgentIntegrationsConfigs(t *testing.T) {
 	assert.Equal(t, "", rules[1].Service)
 	assert.Equal(t, "", rules[1].Source)
 	assert.Equal(t, 0, len(rules[1].Tags))
+	assert.Equal(t, 65536, rules[1].MaxMessageSize)
+	assert.Equal(t, TRUNCATION_POLICY_DROP, rules[1].TruncationPolicy)
 
 	assert.Equal(t, "docker", rules[2].Type)
 	assert.Equal(t, "test", rules[2].Image)
+	assert.Equal(t, 1, len(rules[2].ProcessingRules))
+	assert.Equal(t, EXTRACT_TO_TAGS, rules[2].ProcessingRules[0].ExtractTo)
+	assert.Equal(t, []string{"200", "512"}, rules[2].ProcessingRules[0].Reg.FindStringSubmatch(`"GET / HTTP/1.1" 200 512`)[1:])
 
 	// processing
 	assert.Equal(t, 0, len(rules[0].ProcessingRules))
@@ -61,6 +72,203 @@ func TestBuildLogsAgentIntegrationsConfigs(t *testing.T) {
 	re := mRule.Reg
 	assert.True(t, re.MatchString("123"))
 	assert.False(t, re.MatchString("a123"))
+	assert.Equal(t, 500, mRule.MaxLines)
+	assert.Equal(t, 5, mRule.FlushTimeout)
+	assert.False(t, mRule.Negate)
+	assert.Nil(t, mRule.EndReg)
+}
+
+func TestValidateMultiLineRules(t *testing.T) {
+	rules, err := validateProcessingRules([]LogsProcessingRule{LogsProcessingRule{Type: MULTILINE, Name: "end", EndPattern: ";$", Match: MULTILINE_MATCH_BEFORE}}, newPatternLibrary())
+	assert.Nil(t, err)
+	assert.Nil(t, rules[0].Reg)
+	assert.True(t, rules[0].EndReg.MatchString("end;"))
+
+	// the pattern is anchored to the start of the line without match, as the first line of the logs
+	rules, err = validateProcessingRules([]LogsProcessingRule{
+		LogsProcessingRule{Type: MULTILINE, Name: "first_line", Pattern: "[0-9]"},
+		LogsProcessingRule{Type: MULTILINE, Name: "continuation", Pattern: `\\$`, Match: MULTILINE_MATCH_BEFORE},
+	}, newPatternLibrary())
+	assert.Nil(t, err)
+	assert.False(t, rules[0].Reg.MatchString("a1"))
+	assert.True(t, rules[1].Reg.MatchString(`a \`))
+
+	invalidRules := []LogsProcessingRule{
+		LogsProcessingRule{Type: MULTILINE, Name: "no_pattern"},
+		LogsProcessingRule{Type: MULTILINE, Name: "invalid_pattern", Pattern: "("},
+		LogsProcessingRule{Type: MULTILINE, Name: "invalid_end", Pattern: "[0-9]", EndPattern: "("},
+		LogsProcessingRule{Type: MULTILINE, Name: "negate_without_match", Pattern: "[0-9]", Negate: true},
+		LogsProcessingRule{Type: MULTILINE, Name: "invalid_match", Pattern: "[0-9]", Match: "around"},
+		LogsProcessingRule{Type: MULTILINE, Name: "negative_lines", Pattern: "[0-9]", MaxLines: -1},
+		LogsProcessingRule{Type: MULTILINE, Name: "negative_timeout", Pattern: "[0-9]", FlushTimeout: -1},
+	}
+	for _, rule := range invalidRules {
+		_, err = validateProcessingRules([]LogsProcessingRule{rule}, newPatternLibrary())
+		assert.NotNil(t, err, rule.Name)
+	}
+}
+
+func TestValidateIncludeAtMatchRules(t *testing.T) {
+	rules, err := validateProcessingRules([]LogsProcessingRule{LogsProcessingRule{Type: INCLUDE_AT_MATCH, Name: "errors", Pattern: "ERROR|WARN"}}, newPatternLibrary())
+	assert.Nil(t, err)
+	assert.True(t, rules[0].Reg.MatchString("[WARN] disk full"))
+
+	_, err = validateProcessingRules([]LogsProcessingRule{LogsProcessingRule{Type: INCLUDE_AT_MATCH, Name: "no_pattern"}}, newPatternLibrary())
+	assert.NotNil(t, err)
+	_, err = validateProcessingRules([]LogsProcessingRule{LogsProcessingRule{Type: INCLUDE_AT_MATCH, Name: "invalid", Pattern: "(ERROR"}}, newPatternLibrary())
+	assert.NotNil(t, err)
+}
+
+func TestValidateDedupeRules(t *testing.T) {
+	_, err := validateProcessingRules([]LogsProcessingRule{LogsProcessingRule{Type: DEDUPE, Name: "crash_loops", Window: 60}}, newPatternLibrary())
+	assert.Nil(t, err)
+
+	_, err = validateProcessingRules([]LogsProcessingRule{LogsProcessingRule{Type: DEDUPE, Name: "negative_window", Window: -1}}, newPatternLibrary())
+	assert.NotNil(t, err)
+	_, err = validateProcessingRules([]LogsProcessingRule{LogsProcessingRule{Type: DEDUPE, Name: "first"}, LogsProcessingRule{Type: DEDUPE, Name: "second"}}, newPatternLibrary())
+	assert.NotNil(t, err)
+}
+
+func TestValidateSeverityRules(t *testing.T) {
+	rules, err := validateProcessingRules([]LogsProcessingRule{LogsProcessingRule{Type: SEVERITY, Name: "glog_errors", Pattern: `^E\d{4}`, Level: "Error"}}, newPatternLibrary())
+	assert.Nil(t, err)
+	assert.True(t, rules[0].Reg.MatchString("E1016 12:00:00.000000 1 main.go:42] failed"))
+
+	invalidRules := []LogsProcessingRule{
+		LogsProcessingRule{Type: SEVERITY, Name: "no_pattern", Level: "error"},
+		LogsProcessingRule{Type: SEVERITY, Name: "invalid_pattern", Pattern: "(E", Level: "error"},
+		LogsProcessingRule{Type: SEVERITY, Name: "no_level", Pattern: "^E"},
+		LogsProcessingRule{Type: SEVERITY, Name: "unknown_level", Pattern: "^E", Level: "bad"},
+	}
+	for _, rule := range invalidRules {
+		_, err = validateProcessingRules([]LogsProcessingRule{rule}, newPatternLibrary())
+		assert.NotNil(t, err, rule.Name)
+	}
+}
+
+func TestValidateTimestampRules(t *testing.T) {
+	for _, layout := range []string{TIMESTAMP_LAYOUT_UNIX, TIMESTAMP_LAYOUT_UNIX_MS, TIMESTAMP_LAYOUT_RFC3339, TIMESTAMP_LAYOUT_COMMON_LOG, TIMESTAMP_LAYOUT_SYSLOG, "2006-01-02 15:04:05.000"} {
+		rules, err := validateProcessingRules([]LogsProcessingRule{LogsProcessingRule{Type: TIMESTAMP, Name: "date", Pattern: `^(\S+)`, Layout: layout}}, newPatternLibrary())
+		assert.Nil(t, err, layout)
+		assert.NotNil(t, rules[0].Reg)
+	}
+
+	invalidRules := []LogsProcessingRule{
+		LogsProcessingRule{Type: TIMESTAMP, Name: "no_pattern", Layout: TIMESTAMP_LAYOUT_UNIX},
+		LogsProcessingRule{Type: TIMESTAMP, Name: "invalid_pattern", Pattern: "(", Layout: TIMESTAMP_LAYOUT_UNIX},
+		LogsProcessingRule{Type: TIMESTAMP, Name: "no_layout", Pattern: `^(\S+)`},
+		LogsProcessingRule{Type: TIMESTAMP, Name: "invalid_layout", Pattern: `^(\S+)`, Layout: "yyyy-MM-dd"},
+		LogsProcessingRule{Type: TIMESTAMP, Name: "layout_without_year", Pattern: `^(\S+)`, Layout: "15:04:05"},
+	}
+	for _, rule := range invalidRules {
+		_, err := validateProcessingRules([]LogsProcessingRule{rule}, newPatternLibrary())
+		assert.NotNil(t, err, rule.Name)
+	}
+}
+
+func TestValidateSourceTimestampFallback(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, TimestampFallback: TIMESTAMP_FALLBACK_PREVIOUS}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, TimestampFallback: TIMESTAMP_FALLBACK_INGESTION_TIME}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, TimestampFallback: "zero"}))
+}
+
+func TestValidateExtractRules(t *testing.T) {
+	patterns := newPatternLibrary()
+	patterns["status"] = `%{INT:status}`
+	rules, err := validateProcessingRules([]LogsProcessingRule{LogsProcessingRule{Type: EXTRACT, Name: "access", Pattern: `" %{STATUS} %{NUMBER:duration}$`}}, patterns)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"200", "0.25"}, rules[0].Reg.FindStringSubmatch(`"GET / HTTP/1.1" 200 0.25`)[1:])
+	assert.Equal(t, []string{"", "status", "duration"}, rules[0].Reg.SubexpNames())
+
+	invalidRules := []LogsProcessingRule{
+		LogsProcessingRule{Type: EXTRACT, Name: "unnamed", Pattern: `(\d+)`},
+		LogsProcessingRule{Type: EXTRACT, Name: "invalid", Pattern: `(?P<status>`},
+		LogsProcessingRule{Type: EXTRACT, Name: "unknown_pattern", Pattern: `%{UNKNOWN:status}`},
+		LogsProcessingRule{Type: EXTRACT, Name: "invalid_extract_to", Pattern: `%{INT:status}`, ExtractTo: "header"},
+	}
+	for _, rule := range invalidRules {
+		_, err = validateProcessingRules([]LogsProcessingRule{rule}, patterns)
+		assert.NotNil(t, err, rule.Name)
+	}
+}
+
+func TestValidateSourceExcludePaths(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/*.log", ExcludePaths: []string{"debug-*.log", "/var/log/archive"}}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/*.log", ExcludePaths: []string{"[debug-*.log"}}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/*.log", ExcludePaths: []string{""}}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: DOCKER_TYPE, ExcludePaths: []string{"*.gz"}}))
+}
+
+func TestValidateSourceLogFormat(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", LogFormat: LOG_FORMAT_JSON}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, LogFormat: LOG_FORMAT_JSON}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", LogFormat: "xml"}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/pods/*/*.log", LogFormat: LOG_FORMAT_CRI}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, LogFormat: LOG_FORMAT_CRI}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/lib/docker/containers/*/*-json.log", LogFormat: LOG_FORMAT_DOCKER}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: DOCKER_TYPE, LogFormat: LOG_FORMAT_DOCKER}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, LogFormat: LOG_FORMAT_SYSLOG}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: UDP_TYPE, Port: 1234, LogFormat: LOG_FORMAT_SYSLOG}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", LogFormat: LOG_FORMAT_SYSLOG}))
+}
+
+func TestValidateSourceReadFromDisk(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: DOCKER_TYPE, ReadFromDisk: true}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", ReadFromDisk: true}))
+}
+
+func TestValidateSourceAutoMultiLine(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", AutoMultiLine: true}))
+	rules := []LogsProcessingRule{LogsProcessingRule{Type: MULTILINE, Name: "new_line", Pattern: "[0-9]"}}
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", ProcessingRules: rules}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", AutoMultiLine: true, ProcessingRules: rules}))
+}
+
+func TestValidateSourceEncoding(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log"}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", Encoding: ENCODING_UTF16LE}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", Encoding: ENCODING_LATIN1}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, Encoding: ENCODING_UTF16BE}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", Encoding: "ebcdic"}))
+}
+
+func TestValidateSourceStartPosition(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log"}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", StartPosition: START_POSITION_BEGINNING}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: DOCKER_TYPE, StartPosition: START_POSITION_END}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", StartPosition: START_POSITION_LAST_N_BYTES, LastNBytes: 1024}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", StartPosition: START_POSITION_LAST_N_BYTES}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: DOCKER_TYPE, StartPosition: START_POSITION_LAST_N_BYTES, LastNBytes: 1024}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", StartPosition: "middle"}))
+}
+
+func TestValidateSourceTruncation(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, MaxMessageSize: 1024, TruncationPolicy: TRUNCATION_POLICY_SPLIT}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, MaxMessageSize: -1}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, TruncationPolicy: "ignore"}))
+}
+
+func TestValidateSourceRateLimit(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, RateLimit: 100, RateLimitBurst: 500, SampleRate: 0.1}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, RateLimit: 0.5}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, RateLimit: -1}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, RateLimit: 100, RateLimitBurst: -1}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, RateLimitBurst: 500}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, SampleRate: 1.5}))
+}
+
+func TestValidateSourceDelimiter(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, Delimiter: DELIMITER_NUL}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: FILE_TYPE, Path: "/var/log/app.log", Delimiter: "\x1e"}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: DOCKER_TYPE, Delimiter: DELIMITER_NEWLINE}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: DOCKER_TYPE, Delimiter: DELIMITER_NUL}))
+}
+
+func TestValidateSourceFraming(t *testing.T) {
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, Framing: FRAMING_OCTET_COUNTING}))
+	assert.Nil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, Framing: FRAMING_AUTO}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: UDP_TYPE, Port: 1234, Framing: FRAMING_OCTET_COUNTING}))
+	assert.NotNil(t, validateSource(IntegrationConfigLogSource{Type: TCP_TYPE, Port: 1234, Framing: "length"}))
 }
 
 func TestBuildTagsPayload(t *testing.T) {
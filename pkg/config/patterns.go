@@ -0,0 +1,92 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxPatternDepth is the maximum number of nested pattern references,
+// deeper references are most likely recursive
+const maxPatternDepth = 16
+
+// patternReference matches the references to the patterns of the library in the patterns of the rules,
+// `%{NAME}` or `%{NAME:field}` to capture the field
+var patternReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// defaultPatterns are the patterns available to all rules, patterns defined in conf.d override them
+var defaultPatterns = map[string]string{
+	"int":          `[+-]?\d+`,
+	"number":       `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"word":         `\b\w+\b`,
+	"notspace":     `\S+`,
+	"space":        `\s*`,
+	"data":         `.*?`,
+	"greedydata":   `.*`,
+	"quotedstring": `"(?:[^"\\]|\\.)*"`,
+	"ipv4":         `(?:\d{1,3}\.){3}\d{1,3}`,
+	"hostname":     `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"httpdate":     `\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+	"loglevel":     `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|alert|emerg(?:ency)?)`,
+}
+
+// patternLibrary maps the names of reusable patterns, in lower case, to their regular expressions
+type patternLibrary map[string]string
+
+// newPatternLibrary returns a library holding the default patterns
+func newPatternLibrary() patternLibrary {
+	library := make(patternLibrary)
+	for name, pattern := range defaultPatterns {
+		library[name] = pattern
+	}
+	return library
+}
+
+// add adds the patterns defined in a conf.d file, a pattern can't be defined twice
+func (l patternLibrary) add(patterns map[string]string, defined map[string]bool) error {
+	for name, pattern := range patterns {
+		name = strings.ToLower(name)
+		if defined[name] {
+			return fmt.Errorf("LogsAgent misconfigured: log pattern %s is defined twice", name)
+		}
+		defined[name] = true
+		l[name] = pattern
+	}
+	return nil
+}
+
+// expand replaces the references to the patterns of the library in pattern by their regular expressions
+func (l patternLibrary) expand(pattern string) (string, error) {
+	return l.expandNested(pattern, 0)
+}
+
+// expandNested replaces the references of pattern, which is nested depth times in other patterns
+func (l patternLibrary) expandNested(pattern string, depth int) (string, error) {
+	if depth > maxPatternDepth {
+		return "", fmt.Errorf("log patterns are nested more than %d times", maxPatternDepth)
+	}
+	var err error
+	expanded := patternReference.ReplaceAllStringFunc(pattern, func(reference string) string {
+		submatches := patternReference.FindStringSubmatch(reference)
+		definition, ok := l[strings.ToLower(submatches[1])]
+		if !ok {
+			err = fmt.Errorf("unknown log pattern %s", submatches[1])
+			return reference
+		}
+		definition, expandErr := l.expandNested(definition, depth+1)
+		if expandErr != nil {
+			err = expandErr
+			return reference
+		}
+		if submatches[2] != "" {
+			return "(?P<" + submatches[2] + ">" + definition + ")"
+		}
+		return "(?:" + definition + ")"
+	})
+	return expanded, err
+}
@@ -0,0 +1,43 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandPatterns(t *testing.T) {
+	patterns := newPatternLibrary()
+	assert.Nil(t, patterns.add(map[string]string{"Duration": `%{NUMBER}s`}, make(map[string]bool)))
+
+	expanded, err := patterns.expand(`took %{DURATION:duration}`)
+	assert.Nil(t, err)
+	assert.Equal(t, `took (?P<duration>(?:[+-]?(?:\d+(?:\.\d*)?|\.\d+))s)`, expanded)
+
+	expanded, err = patterns.expand(`no reference`)
+	assert.Nil(t, err)
+	assert.Equal(t, `no reference`, expanded)
+
+	_, err = patterns.expand(`%{UNKNOWN}`)
+	assert.NotNil(t, err)
+}
+
+func TestExpandRecursivePatterns(t *testing.T) {
+	patterns := newPatternLibrary()
+	assert.Nil(t, patterns.add(map[string]string{"a": `%{B}`, "b": `%{A}`}, make(map[string]bool)))
+	_, err := patterns.expand(`%{A:a}`)
+	assert.NotNil(t, err)
+}
+
+func TestAddPatterns(t *testing.T) {
+	patterns := newPatternLibrary()
+	defined := make(map[string]bool)
+	assert.Nil(t, patterns.add(map[string]string{"int": `\d+`}, defined))
+	assert.Equal(t, `\d+`, patterns["int"])
+	assert.NotNil(t, patterns.add(map[string]string{"INT": `[0-9]+`}, defined))
+}
@@ -0,0 +1,165 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+)
+
+// autoMultiLineSampleSize is the number of lines sampled to detect the format of a source
+const autoMultiLineSampleSize = 100
+
+// autoMultiLineSampleTimeout is the time we wait for the sample to be complete
+// before detecting the format of a source on the lines received so far
+const autoMultiLineSampleTimeout = 2 * time.Second
+
+// autoMultiLineMinMatchRatio is the minimum ratio of sampled lines
+// a format must match to be detected, multi-line logs are mostly made of
+// the lines following their first line, like the frames of stack traces
+const autoMultiLineMinMatchRatio = 0.1
+
+const months = `(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)`
+
+// autoMultiLineFormats are the usual prefixes of the first line of a log,
+// from the most to the least specific
+var autoMultiLineFormats = []*regexp.Regexp{
+	// 2017-10-16T12:00:00, 2017-10-16 12:00:00
+	regexp.MustCompile(`^\[?\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}`),
+	// 2017/10/16 12:00:00
+	regexp.MustCompile(`^\[?\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}`),
+	// 10/16/2017 12:00:00, 16/10/2017:12:00:00
+	regexp.MustCompile(`^\[?\d{2}/\d{2}/\d{4}[ :]\d{2}:\d{2}:\d{2}`),
+	// 16/Oct/2017:12:00:00
+	regexp.MustCompile(`^\[?\d{2}/` + months + `/\d{4}:\d{2}:\d{2}:\d{2}`),
+	// Oct 16 12:00:00
+	regexp.MustCompile(`^\[?` + months + ` +\d{1,2} \d{2}:\d{2}:\d{2}`),
+	// 12:00:00
+	regexp.MustCompile(`^\[?\d{2}:\d{2}:\d{2}`),
+	// ERROR, [WARN]
+	regexp.MustCompile(`^\[?(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|CRITICAL|FATAL)\b`),
+}
+
+// AutoMultiLineHandler samples the first lines of a source to detect the format
+// of the first line of its logs, then forwards lines to a MultiLineLineHandler
+// grouping the lines that don't follow this format with the previous ones,
+// or to a SingleLineHandler when no format is detected
+type AutoMultiLineHandler struct {
+	lineChan      chan *Line
+	outputChan    chan *Output
+	sample        []*Line
+	sampleSize    int
+	sampleTimeout time.Duration
+	truncation    truncation
+	lineHandler   LineHandler
+}
+
+// NewAutoMultiLineHandler returns a new AutoMultiLineHandler
+func NewAutoMultiLineHandler(outputChan chan *Output) *AutoMultiLineHandler {
+	return newAutoMultiLineHandler(outputChan, defaultTruncation())
+}
+
+// newAutoMultiLineHandler returns a new AutoMultiLineHandler
+// whose handlers apply truncation to long contents
+func newAutoMultiLineHandler(outputChan chan *Output, t truncation) *AutoMultiLineHandler {
+	lineHandler := AutoMultiLineHandler{
+		lineChan:      make(chan *Line),
+		outputChan:    outputChan,
+		sampleSize:    autoMultiLineSampleSize,
+		sampleTimeout: autoMultiLineSampleTimeout,
+		truncation:    t,
+	}
+	go lineHandler.start()
+	return &lineHandler
+}
+
+// Handle forward lines to lineChan to process them
+func (lh *AutoMultiLineHandler) Handle(line *Line) {
+	lh.lineChan <- line
+}
+
+// Stop stops the handler from processing new lines
+func (lh *AutoMultiLineHandler) Stop() {
+	close(lh.lineChan)
+}
+
+// start samples lines until the format is detected, then forwards lines to the handler of this format
+func (lh *AutoMultiLineHandler) start() {
+	var sampleTimeout <-chan time.Time
+	for lh.lineHandler == nil {
+		select {
+		case line, isOpen := <-lh.lineChan:
+			if !isOpen {
+				lh.setLineHandler()
+				lh.lineHandler.Stop()
+				return
+			}
+			if sampleTimeout == nil {
+				sampleTimeout = time.After(lh.sampleTimeout)
+			}
+			lh.sample = append(lh.sample, line)
+			if len(lh.sample) >= lh.sampleSize {
+				lh.setLineHandler()
+			}
+		case <-sampleTimeout:
+			lh.setLineHandler()
+		}
+	}
+	for line := range lh.lineChan {
+		lh.lineHandler.Handle(line)
+	}
+	lh.lineHandler.Stop()
+}
+
+// setLineHandler sets the handler of the format detected on the sample,
+// and forwards it the sampled lines
+func (lh *AutoMultiLineHandler) setLineHandler() {
+	contents := [][]byte{}
+	for _, line := range lh.sample {
+		contents = append(contents, line.content)
+	}
+	if format := detectFormat(contents); format != nil {
+		lh.lineHandler = newMultiLineLineHandler(lh.outputChan, config.LogsProcessingRule{Reg: format}, lh.truncation)
+	} else {
+		lh.lineHandler = newSingleLineHandler(lh.outputChan, lh.truncation)
+	}
+	for _, line := range lh.sample {
+		lh.lineHandler.Handle(line)
+	}
+	lh.sample = nil
+}
+
+// detectFormat returns the format of the first line matched by the most lines,
+// or nil if the first line has no known format, another format matches more lines,
+// or not enough lines match it
+func detectFormat(contents [][]byte) *regexp.Regexp {
+	if len(contents) == 0 {
+		return nil
+	}
+	var detectedFormat *regexp.Regexp
+	maxMatches, maxOtherMatches := 0, 0
+	for _, format := range autoMultiLineFormats {
+		matches := 0
+		for _, content := range contents {
+			if format.Match(content) {
+				matches++
+			}
+		}
+		switch {
+		case format.Match(contents[0]) && matches > maxMatches:
+			detectedFormat = format
+			maxMatches = matches
+		case !format.Match(contents[0]) && matches > maxOtherMatches:
+			maxOtherMatches = matches
+		}
+	}
+	if detectedFormat == nil || maxOtherMatches > maxMatches || float64(maxMatches) < autoMultiLineMinMatchRatio*float64(len(contents)) {
+		return nil
+	}
+	return detectedFormat
+}
@@ -0,0 +1,123 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func lineContents(lines ...string) [][]byte {
+	contents := [][]byte{}
+	for _, line := range lines {
+		contents = append(contents, []byte(line))
+	}
+	return contents
+}
+
+func TestDetectFormat(t *testing.T) {
+	// stack traces are mostly made of lines following the first one
+	javaLogs := lineContents(
+		"2017-10-16 12:00:00,000 ERROR Something went wrong",
+		"java.lang.NullPointerException",
+		"\tat com.example.Service.handle(Service.java:87)",
+		"\tat com.example.Server.dispatch(Server.java:153)",
+		"\tat com.example.Server.run(Server.java:64)",
+		"\tat java.lang.Thread.run(Thread.java:748)",
+		"2017-10-16 12:00:01,000 INFO Recovered",
+	)
+	assert.Equal(t, autoMultiLineFormats[0], detectFormat(javaLogs))
+
+	goLogs := lineContents(
+		"2017/10/16 12:00:00 panic: runtime error: index out of range",
+		"",
+		"goroutine 1 [running]:",
+		"main.handle(0xc42000e1e0, 0x3, 0x3)",
+		"\t/go/src/app/main.go:12 +0x125",
+		"main.main()",
+		"\t/go/src/app/main.go:20 +0x4b",
+		"exit status 2",
+	)
+	assert.Equal(t, autoMultiLineFormats[1], detectFormat(goLogs))
+
+	syslogs := lineContents("Oct 16 12:00:00 host app[42]: hello", "Oct  6 12:00:01 host app[42]: world")
+	assert.Equal(t, autoMultiLineFormats[4], detectFormat(syslogs))
+
+	levelLogs := lineContents("[ERROR] boom", "  at main", "[INFO] ok")
+	assert.Equal(t, autoMultiLineFormats[6], detectFormat(levelLogs))
+
+	assert.Nil(t, detectFormat(lineContents("hello world", "how are you")))
+	assert.Nil(t, detectFormat(lineContents()))
+
+	// not enough lines follow the format
+	rareFormat := lineContents("2017-10-16 12:00:00 hello")
+	for i := 0; i < 20; i++ {
+		rareFormat = append(rareFormat, []byte("hello world"))
+	}
+	assert.Nil(t, detectFormat(rareFormat))
+
+	// single line logs where timestamps appear here and there
+	mixedLogs := lineContents(
+		"GET /index.html 200",
+		"GET /favicon.ico 404",
+		"2017-10-16 12:00:05 cache refreshed",
+		"POST /login 302",
+		"GET /home 200",
+		"2017-10-16 12:00:09 cache refreshed",
+		"GET /logout 302",
+	)
+	assert.Nil(t, detectFormat(mixedLogs))
+
+	// the first line follows a format matched by less lines than another one
+	competingFormats := lineContents(
+		"12:00:00 starting",
+		"2017-10-16 12:00:01 ready",
+		"2017-10-16 12:00:02 serving",
+		"2017-10-16 12:00:03 stopping",
+	)
+	assert.Nil(t, detectFormat(competingFormats))
+}
+
+func TestAutoMultiLineHandlerGroupsLines(t *testing.T) {
+	outputChan := make(chan *Output, 10)
+	h := NewAutoMultiLineHandler(outputChan)
+	h.Handle(NewLine([]byte("2017-10-16 12:00:00 ERROR boom"), 31))
+	h.Handle(NewLine([]byte("\tat main"), 9))
+	h.Handle(NewLine([]byte("2017-10-16 12:00:01 INFO ok"), 28))
+	h.Stop()
+
+	output := <-outputChan
+	assert.Equal(t, "2017-10-16 12:00:00 ERROR boom\\n\tat main", string(output.Content))
+	assert.Equal(t, 40, output.RawDataLen)
+	output = <-outputChan
+	assert.Equal(t, "2017-10-16 12:00:01 INFO ok", string(output.Content))
+	assert.Equal(t, 28, output.RawDataLen)
+	output = <-outputChan
+	assert.True(t, output.ShouldStop)
+}
+
+func TestAutoMultiLineHandlerFallsBackToSingleLines(t *testing.T) {
+	outputChan := make(chan *Output, 10)
+	h := NewAutoMultiLineHandler(outputChan)
+	h.sampleTimeout = 10 * time.Millisecond
+	h.Handle(NewLine([]byte("hello"), 6))
+	h.Handle(NewLine([]byte("world"), 6))
+
+	// the sample is incomplete, lines are sent once it times out
+	output := <-outputChan
+	assert.Equal(t, "hello", string(output.Content))
+	output = <-outputChan
+	assert.Equal(t, "world", string(output.Content))
+
+	h.Handle(NewLine([]byte("2017-10-16 12:00:00 ERROR boom"), 31))
+	output = <-outputChan
+	assert.Equal(t, "2017-10-16 12:00:00 ERROR boom", string(output.Content))
+	h.Stop()
+	output = <-outputChan
+	assert.True(t, output.ShouldStop)
+}
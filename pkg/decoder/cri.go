@@ -0,0 +1,55 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+)
+
+// criPartialTag marks the lines split by the container runtime,
+// their content continues on the next line
+var criPartialTag = []byte("P")
+
+// criStderr is the stream of the lines written to stderr
+var criStderr = []byte("stderr")
+
+// criParser parses the lines of the log files written by the container runtimes
+// implementing the CRI, like containerd: `<timestamp> <stream> <P|F> <content>`
+type criParser struct {
+	partial partialLine
+}
+
+// newCRIParser returns a new criParser joining split lines up to maxLen
+func newCRIParser(maxLen int) *criParser {
+	return &criParser{partial: partialLine{maxLen: maxLen}}
+}
+
+// parse returns line without its CRI prefix, along with its timestamp and severity.
+// Partial lines are joined with the next ones, parse returns nil until the line is complete.
+// Lines not following the format are returned as is
+func (p *criParser) parse(line *Line) *Line {
+	fields := bytes.SplitN(line.content, []byte{' '}, 4)
+	if len(fields) < 3 {
+		return line
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, string(fields[0]))
+	if err != nil {
+		return line
+	}
+	content := []byte{}
+	if len(fields) == 4 {
+		content = fields[3]
+	}
+
+	var severity []byte
+	if bytes.Equal(fields[1], criStderr) {
+		severity = config.SEV_ERROR
+	}
+	return p.partial.join(line, content, timestamp.UTC().Format(config.DateFormat), severity, bytes.Equal(fields[2], criPartialTag))
+}
@@ -0,0 +1,75 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCRILine(content string) *Line {
+	return NewLine([]byte(content), len(content)+1)
+}
+
+func TestCRIParserParsesLines(t *testing.T) {
+	p := newCRIParser(contentLenLimit)
+	line := p.parse(newCRILine("2017-10-16T12:00:00.123456789+02:00 stdout F hello world"))
+	assert.Equal(t, "hello world", string(line.content))
+	assert.Equal(t, 57, line.rawDataLen)
+	assert.Equal(t, "2017-10-16T10:00:00.123456789Z", line.timestamp)
+	assert.Nil(t, line.severity)
+
+	line = p.parse(newCRILine("2017-10-16T12:00:00Z stderr F error"))
+	assert.Equal(t, "error", string(line.content))
+	assert.Equal(t, config.SEV_ERROR, line.severity)
+
+	line = p.parse(newCRILine("2017-10-16T12:00:00Z stdout F"))
+	assert.Equal(t, "", string(line.content))
+}
+
+func TestCRIParserJoinsPartialLines(t *testing.T) {
+	p := newCRIParser(contentLenLimit)
+	assert.Nil(t, p.parse(newCRILine("2017-10-16T12:00:00Z stderr P hello ")))
+	assert.Nil(t, p.parse(newCRILine("2017-10-16T12:00:01Z stderr P wor")))
+	line := p.parse(newCRILine("2017-10-16T12:00:02Z stderr F ld"))
+	assert.Equal(t, "hello world", string(line.content))
+	assert.Equal(t, 37+34+33, line.rawDataLen)
+	assert.Equal(t, "2017-10-16T12:00:00.000000000Z", line.timestamp)
+	assert.Equal(t, config.SEV_ERROR, line.severity)
+
+	// partial lines are not joined beyond the length limit
+	assert.Nil(t, p.parse(newCRILine("2017-10-16T12:00:00Z stdout P "+strings.Repeat("a", contentLenLimit/2))))
+	line = p.parse(newCRILine("2017-10-16T12:00:00Z stdout P " + strings.Repeat("a", contentLenLimit/2)))
+	assert.Equal(t, contentLenLimit, len(line.content))
+}
+
+func TestCRIParserPassesThroughOtherLines(t *testing.T) {
+	p := newCRIParser(contentLenLimit)
+	for _, content := range []string{"hello world", "hello", "yesterday stdout F hello"} {
+		line := p.parse(newCRILine(content))
+		assert.Equal(t, content, string(line.content))
+		assert.Equal(t, "", line.timestamp)
+	}
+}
+
+func TestDecoderParsesCRILines(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, LogFormat: config.LOG_FORMAT_CRI}
+	d := InitializeDecoder(source)
+	d.Start()
+	d.InputChan <- NewInput([]byte("2017-10-16T12:00:00Z stderr P hello \n2017-10-16T12:00:01Z stderr F world\n"))
+
+	out := <-d.OutputChan
+	assert.Equal(t, "hello world", string(out.Content))
+	assert.Equal(t, 73, out.RawDataLen)
+	assert.Equal(t, "2017-10-16T12:00:00.000000000Z", out.Timestamp)
+	assert.Equal(t, config.SEV_ERROR, out.Severity)
+	d.Stop()
+	out = <-d.OutputChan
+	assert.True(t, out.ShouldStop)
+}
@@ -7,13 +7,18 @@ package decoder
 
 import (
 	"bytes"
+	"unicode/utf8"
 
 	"github.com/DataDog/datadog-log-agent/pkg/config"
 )
 
-// contentLenLimit represents the length limit above which we want to truncate the output content
+// contentLenLimit represents the default length limit above which we want to truncate the output content
 var contentLenLimit = 256 * 1000
 
+var newline = []byte{'\n'}
+var escapedNewline = []byte(`\n`)
+var carriageReturn = []byte{'\r'}
+
 // Input represents a list of bytes consumed by the Decoder
 type Input struct {
 	content []byte
@@ -29,6 +34,8 @@ type Output struct {
 	Content    []byte
 	RawDataLen int
 	ShouldStop bool
+	Timestamp  string // set when the format of the source provides it
+	Severity   []byte // set when the format of the source provides it
 }
 
 // newOutput returns a new decoder output
@@ -39,6 +46,12 @@ func NewOutput(content []byte, rawDataLen int) *Output {
 	}
 }
 
+// setMetadata sets the metadata of the line the output was built from
+func (o *Output) setMetadata(line *Line) {
+	o.Timestamp = line.timestamp
+	o.Severity = line.severity
+}
+
 // newOutputStop returns a new decoder output stop
 func newStopOutput() *Output {
 	return &Output{ShouldStop: true}
@@ -49,8 +62,18 @@ type Decoder struct {
 	InputChan  chan *Input
 	OutputChan chan *Output
 
-	lineBuffer  *bytes.Buffer
-	lineHandler LineHandler
+	lineBuffer      *bytes.Buffer
+	rawDataLen      int
+	contentLenLimit int
+	delimiter       []byte
+	framing         string
+	framingDetected bool
+	frameHeader     []byte
+	invalidFrame    bool
+	frameLen        int
+	lineHandler     LineHandler
+	transcoder      transcoder
+	lineParser      lineParser
 }
 
 // InitializeDecoder returns a properly initialized Decoder
@@ -58,31 +81,61 @@ func InitializeDecoder(source *config.IntegrationConfigLogSource) *Decoder {
 	inputChan := make(chan *Input)
 	outputChan := make(chan *Output)
 
+	truncation := newTruncation(source)
 	var lineHandler LineHandler
 	for _, rule := range source.ProcessingRules {
 		switch rule.Type {
 		case config.MULTILINE:
-			lineHandler = NewMultiLineLineHandler(outputChan, rule.Reg)
+			lineHandler = newMultiLineLineHandler(outputChan, rule, truncation)
 		}
 	}
+	if lineHandler == nil && source.AutoMultiLine {
+		lineHandler = newAutoMultiLineHandler(outputChan, truncation)
+	}
 	if lineHandler == nil {
-		lineHandler = NewSingleLineHandler(outputChan)
+		lineHandler = newSingleLineHandler(outputChan, truncation)
 	}
 
-	return New(inputChan, outputChan, lineHandler)
+	d := New(inputChan, outputChan, lineHandler)
+	d.contentLenLimit = truncation.maxLen
+	d.delimiter = delimiter(source)
+	d.framing = source.Framing
+	d.transcoder = newTranscoder(source.Encoding)
+	d.lineParser = newLineParser(source.LogFormat, truncation.maxLen)
+	return d
 }
 
 // New returns an initialized Decoder
 func New(InputChan chan *Input, OutputChan chan *Output, lineHandler LineHandler) *Decoder {
 	var lineBuffer bytes.Buffer
 	return &Decoder{
-		InputChan:   InputChan,
-		OutputChan:  OutputChan,
-		lineBuffer:  &lineBuffer,
-		lineHandler: lineHandler,
+		InputChan:       InputChan,
+		OutputChan:      OutputChan,
+		lineBuffer:      &lineBuffer,
+		contentLenLimit: contentLenLimit,
+		delimiter:       newline,
+		lineHandler:     lineHandler,
+	}
+}
+
+// delimiter returns the delimiter of the lines of source
+func delimiter(source *config.IntegrationConfigLogSource) []byte {
+	switch source.Delimiter {
+	case "", config.DELIMITER_NEWLINE:
+		return newline
+	case config.DELIMITER_NUL:
+		return []byte{0}
+	default:
+		return []byte(source.Delimiter)
 	}
 }
 
+// RawDelimiter returns the delimiter of the lines of source
+// as it is written by the source, before transcoding
+func RawDelimiter(source *config.IntegrationConfigLogSource) []byte {
+	return encode(delimiter(source), source.Encoding)
+}
+
 // Start starts the Decoder
 func (d *Decoder) Start() {
 	go d.run()
@@ -96,40 +149,114 @@ func (d *Decoder) Stop() {
 // run lets the Decoder handle data coming from InputChan
 func (d *Decoder) run() {
 	for data := range d.InputChan {
-		d.decodeIncomingData(data.content)
+		if d.transcoder != nil {
+			d.decode(d.transcoder.transcode(data.content))
+		} else {
+			d.decode(data.content)
+		}
 	}
 	// finish to stop decoder
 	d.lineHandler.Stop()
 }
 
-// decodeIncomingData splits raw data based on '\n', creates and processes new lines
+// decode splits raw data into lines following the framing of the source
+func (d *Decoder) decode(inBuf []byte) {
+	if d.framing == config.FRAMING_AUTO && len(inBuf) > 0 {
+		d.framing = detectFraming(inBuf)
+		d.framingDetected = true
+	}
+	if d.framing == config.FRAMING_OCTET_COUNTING {
+		d.decodeFrames(inBuf)
+	} else {
+		d.decodeIncomingData(inBuf)
+	}
+}
+
+// decodeIncomingData splits raw data based on the delimiter, creates and processes new lines
 func (d *Decoder) decodeIncomingData(inBuf []byte) {
 	i, j := 0, 0
 	n := len(inBuf)
-	maxj := contentLenLimit - d.lineBuffer.Len()
+	maxj := d.contentLenLimit - d.lineBuffer.Len()
+	lastDelimiterByte := d.delimiter[len(d.delimiter)-1]
 
 	for ; j < n; j++ {
-		if j == maxj {
+		// the delimiter is looked for first, a delimiter ending at the limit
+		// may start before it, in the line or in lineBuffer
+		if inBuf[j] == lastDelimiterByte && d.endsWithDelimiter(inBuf[i:j+1]) {
+			// the delimiter is counted in the length of the line, but is not part of its content
+			d.writeLine(inBuf[i : j+1])
+			d.lineBuffer.Truncate(d.lineBuffer.Len() - len(d.delimiter))
+			d.sendLine(false)
+			i = j + 1
+			maxj = i + d.contentLenLimit
+		} else if j == maxj {
+			if d.transcoder != nil {
+				// don't split a character, its original length would be lost
+				for j > i && !utf8.RuneStart(inBuf[j]) {
+					j--
+				}
+			}
 			// send line because it is too long
-			d.lineBuffer.Write(inBuf[i:j])
-			d.sendLine()
+			d.writeLine(inBuf[i:j])
+			d.sendLine(true)
 			i = j
-			maxj = i + contentLenLimit
-		} else if inBuf[j] == '\n' {
-			d.lineBuffer.Write(inBuf[i:j])
-			d.sendLine()
-			i = j + 1 // +1 as we skip the `\n`
-			maxj = i + contentLenLimit
+			maxj = i + d.contentLenLimit
+			// the first byte of the next line is checked again
+			j--
 		}
 	}
-	d.lineBuffer.Write(inBuf[i:j])
+	d.writeLine(inBuf[i:j])
+}
+
+// writeLine adds content to lineBuffer and counts its length before transcoding
+func (d *Decoder) writeLine(content []byte) {
+	d.lineBuffer.Write(content)
+	if d.transcoder != nil {
+		d.rawDataLen += d.transcoder.rawLen(content)
+	} else {
+		d.rawDataLen += len(content)
+	}
+}
+
+// endsWithDelimiter returns true if the line, made of lineBuffer followed by data, ends with the delimiter
+func (d *Decoder) endsWithDelimiter(data []byte) bool {
+	if len(data) >= len(d.delimiter) {
+		return bytes.HasSuffix(data, d.delimiter)
+	}
+	// the begining of the delimiter is in lineBuffer
+	k := len(d.delimiter) - len(data)
+	return bytes.Equal(data, d.delimiter[k:]) && bytes.HasSuffix(d.lineBuffer.Bytes(), d.delimiter[:k])
 }
 
-// sendLine copies content from lineBuffer which is passed to lineHandler
-func (d *Decoder) sendLine() {
+// sendLine copies content from lineBuffer which is passed to lineHandler,
+// truncated is true when the line is split because it reached the length limit
+func (d *Decoder) sendLine(truncated bool) {
 	content := make([]byte, d.lineBuffer.Len())
 	copy(content, d.lineBuffer.Bytes())
 	d.lineBuffer.Reset()
-	newLine := NewLine(content)
+	if d.transcoder != nil {
+		content = bytes.TrimPrefix(content, byteOrderMark)
+	}
+	if bytes.Equal(d.delimiter, newline) {
+		content = bytes.TrimSuffix(content, carriageReturn)
+	} else {
+		// a line can't span several lines once sent
+		content = bytes.Replace(content, newline, escapedNewline, -1)
+	}
+	newLine := NewLine(content, d.rawDataLen)
+	newLine.truncated = truncated
+	d.rawDataLen = 0
+	d.handleLine(newLine)
+}
+
+// handleLine parses newLine and passes it to lineHandler
+func (d *Decoder) handleLine(newLine *Line) {
+	if d.lineParser != nil {
+		newLine = d.lineParser.parse(newLine)
+		if newLine == nil {
+			// the line continues on the next one
+			return
+		}
+	}
 	d.lineHandler.Handle(newLine)
 }
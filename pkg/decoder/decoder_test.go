@@ -6,11 +6,14 @@
 package decoder
 
 import (
+	"expvar"
 	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/DataDog/datadog-log-agent/pkg/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -199,6 +202,315 @@ func TestDecodeIncomingDataForMultiLineLogs(t *testing.T) {
 	assert.Equal(t, string(TRUNCATED)+strings.Repeat("a", 10), string(out.Content))
 }
 
+func TestDecoderTranscodesInput(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Encoding: config.ENCODING_UTF16LE}
+	d := InitializeDecoder(source)
+	d.Start()
+
+	// a byte order mark, then "héllo\nworld\n" split in the middle of characters
+	d.InputChan <- NewInput([]byte{0xff, 0xfe, 'h', 0, 0xe9})
+	d.InputChan <- NewInput([]byte{0, 'l', 0, 'l', 0, 'o', 0, '\n'})
+	d.InputChan <- NewInput([]byte{0, 'w', 0, 'o', 0, 'r', 0, 'l', 0, 'd', 0, '\n', 0})
+
+	out := <-d.OutputChan
+	assert.Equal(t, "héllo", string(out.Content))
+	assert.Equal(t, 14, out.RawDataLen)
+	out = <-d.OutputChan
+	assert.Equal(t, "world", string(out.Content))
+	assert.Equal(t, 12, out.RawDataLen)
+
+	d.Stop()
+	out = <-d.OutputChan
+	assert.True(t, out.ShouldStop)
+}
+
+func handleLines(lh LineHandler, lines ...string) {
+	for _, line := range lines {
+		lh.Handle(NewLine([]byte(line), len(line)+1))
+	}
+}
+
+func TestMultiLineHandlerWithEndPattern(t *testing.T) {
+	outChan := make(chan *Output, 10)
+	rule := config.LogsProcessingRule{Reg: regexp.MustCompile("^[0-9]+\\."), EndReg: regexp.MustCompile(";$")}
+	lh := NewMultiLineLineHandlerFromRule(outChan, rule)
+
+	handleLines(lh, "1. Hello", "world;", "2. How are you")
+	out := <-outChan
+	assert.Equal(t, "1. Hello\\nworld;", string(out.Content))
+	assert.Equal(t, 16, out.RawDataLen)
+	lh.Stop()
+	out = <-outChan
+	assert.Equal(t, "2. How are you", string(out.Content))
+}
+
+func TestMultiLineHandlerMatchesLikeFilebeat(t *testing.T) {
+	// the examples of the Filebeat documentation
+	tests := []struct {
+		name     string
+		rule     config.LogsProcessingRule
+		lines    []string
+		contents []string
+	}{
+		{
+			name:     "indented lines are appended to the previous line",
+			rule:     config.LogsProcessingRule{Reg: regexp.MustCompile(`^[[:space:]]`), Match: config.MULTILINE_MATCH_AFTER},
+			lines:    []string{"Exception in thread \"main\"", "  at com.example.App.main", "  at com.example.App.init", "Done"},
+			contents: []string{"Exception in thread \"main\"\\n  at com.example.App.main\\n  at com.example.App.init", "Done"},
+		},
+		{
+			name:     "lines ending with a backslash are prepended to the next line",
+			rule:     config.LogsProcessingRule{Reg: regexp.MustCompile(`\\$`), Match: config.MULTILINE_MATCH_BEFORE},
+			lines:    []string{"printf (\"%10.10ld  \\t %10.10ld \\t %s\\", "  %f\", w, x, y, z );", "Done"},
+			contents: []string{"printf (\"%10.10ld  \\t %10.10ld \\t %s\\\\n  %f\", w, x, y, z );", "Done"},
+		},
+		{
+			name:     "lines not starting with a timestamp are appended to the previous line",
+			rule:     config.LogsProcessingRule{Reg: regexp.MustCompile(`^\[[0-9]{4}-[0-9]{2}-[0-9]{2}`), Negate: true, Match: config.MULTILINE_MATCH_AFTER},
+			lines:    []string{"[2015-08-24 11:49:14,389][INFO ][env] using [1] data paths", "mounts [[/ (/dev/disk1)]]", "[2015-08-24 11:49:15,000][INFO ][env] done"},
+			contents: []string{"[2015-08-24 11:49:14,389][INFO ][env] using [1] data paths\\nmounts [[/ (/dev/disk1)]]", "[2015-08-24 11:49:15,000][INFO ][env] done"},
+		},
+		{
+			name:     "lines not ending with a semicolon are prepended to the next line",
+			rule:     config.LogsProcessingRule{Reg: regexp.MustCompile(`;$`), Negate: true, Match: config.MULTILINE_MATCH_BEFORE},
+			lines:    []string{"SELECT *", "FROM logs", "WHERE id = 1;", "COMMIT;"},
+			contents: []string{"SELECT *\\nFROM logs\\nWHERE id = 1;", "COMMIT;"},
+		},
+	}
+	for _, test := range tests {
+		outChan := make(chan *Output, 10)
+		lh := NewMultiLineLineHandlerFromRule(outChan, test.rule)
+		handleLines(lh, test.lines...)
+		lh.Stop()
+		for _, content := range test.contents {
+			out := <-outChan
+			assert.Equal(t, content, string(out.Content), test.name)
+		}
+		out := <-outChan
+		assert.True(t, out.ShouldStop, test.name)
+	}
+}
+
+func TestMultiLineHandlerWithMaxLines(t *testing.T) {
+	outChan := make(chan *Output, 10)
+	rule := config.LogsProcessingRule{Reg: regexp.MustCompile("^[0-9]+\\."), MaxLines: 2}
+	lh := NewMultiLineLineHandlerFromRule(outChan, rule)
+
+	handleLines(lh, "1. Hello", "a", "b", "c")
+	out := <-outChan
+	assert.Equal(t, "1. Hello\\na", string(out.Content))
+	out = <-outChan
+	assert.Equal(t, "b\\nc", string(out.Content))
+	lh.Stop()
+	out = <-outChan
+	assert.True(t, out.ShouldStop)
+}
+
+func TestMultiLineHandlerWithFlushTimeout(t *testing.T) {
+	outChan := make(chan *Output, 10)
+	rule := config.LogsProcessingRule{Reg: regexp.MustCompile("^[0-9]+\\."), FlushTimeout: 2}
+	lh := NewMultiLineLineHandlerFromRule(outChan, rule)
+
+	handleLines(lh, "1. Hello", "world")
+	select {
+	case out := <-outChan:
+		assert.Fail(t, "flushed before the timeout", string(out.Content))
+	case <-time.After(1500 * time.Millisecond):
+	}
+	out := <-outChan
+	assert.Equal(t, "1. Hello\\nworld", string(out.Content))
+	lh.Stop()
+	out = <-outChan
+	assert.True(t, out.ShouldStop)
+}
+
+func TestDecoderStripsCarriageReturns(t *testing.T) {
+	outChan := make(chan *Output, 10)
+	d := New(nil, outChan, NewSingleLineHandler(outChan))
+	d.decodeIncomingData([]byte("hello\r\nworld\r"))
+	d.decodeIncomingData([]byte("\n"))
+	out := <-outChan
+	assert.Equal(t, "hello", string(out.Content))
+	assert.Equal(t, 7, out.RawDataLen)
+	out = <-outChan
+	assert.Equal(t, "world", string(out.Content))
+	assert.Equal(t, 7, out.RawDataLen)
+}
+
+func TestDecoderWithNulDelimiter(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Type: config.TCP_TYPE, Delimiter: config.DELIMITER_NUL}
+	d := InitializeDecoder(source)
+	d.Start()
+	d.InputChan <- NewInput([]byte("hello\nworld\x00again\x00"))
+
+	out := <-d.OutputChan
+	assert.Equal(t, "hello\\nworld", string(out.Content))
+	assert.Equal(t, 12, out.RawDataLen)
+	out = <-d.OutputChan
+	assert.Equal(t, "again", string(out.Content))
+	assert.Equal(t, 6, out.RawDataLen)
+	d.Stop()
+}
+
+func TestDecoderWithCustomDelimiter(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Delimiter: "<EOR>"}
+	d := InitializeDecoder(source)
+	d.Start()
+	// the delimiter is split between inputs
+	d.InputChan <- NewInput([]byte("hello<EO"))
+	d.InputChan <- NewInput([]byte("R><world<EOR"))
+	d.InputChan <- NewInput([]byte(">"))
+
+	out := <-d.OutputChan
+	assert.Equal(t, "hello", string(out.Content))
+	assert.Equal(t, 10, out.RawDataLen)
+	out = <-d.OutputChan
+	assert.Equal(t, "<world", string(out.Content))
+	assert.Equal(t, 11, out.RawDataLen)
+	d.Stop()
+}
+
+func TestDecoderWithDelimiterSplitAtTheLimit(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Delimiter: "||", MaxMessageSize: 6}
+	d := InitializeDecoder(source)
+	d.Start()
+	// the lines reach the limit in the middle of the delimiter, within an input or between inputs
+	d.InputChan <- NewInput([]byte("hello||world|"))
+	d.InputChan <- NewInput([]byte("|again||"))
+
+	out := <-d.OutputChan
+	assert.Equal(t, "hello", string(out.Content))
+	assert.Equal(t, 7, out.RawDataLen)
+	out = <-d.OutputChan
+	assert.Equal(t, "world", string(out.Content))
+	assert.Equal(t, 7, out.RawDataLen)
+	out = <-d.OutputChan
+	assert.Equal(t, "again", string(out.Content))
+	assert.Equal(t, 7, out.RawDataLen)
+	d.Stop()
+}
+
+func TestDecoderWithDelimiterAndTranscoding(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Encoding: config.ENCODING_UTF16LE, Delimiter: config.DELIMITER_NUL}
+	d := InitializeDecoder(source)
+	d.Start()
+	d.InputChan <- NewInput([]byte{'h', 0, 0xe9, 0, 0, 0, 'a', 0})
+	d.InputChan <- NewInput([]byte{0, 0})
+
+	out := <-d.OutputChan
+	assert.Equal(t, "hé", string(out.Content))
+	assert.Equal(t, 6, out.RawDataLen)
+	out = <-d.OutputChan
+	assert.Equal(t, "a", string(out.Content))
+	assert.Equal(t, 4, out.RawDataLen)
+	d.Stop()
+}
+
+func TestDecoderWithMaxMessageSize(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, MaxMessageSize: 10}
+	d := InitializeDecoder(source)
+	d.Start()
+	d.InputChan <- NewInput([]byte("hello\n" + strings.Repeat("a", 15) + "\n"))
+
+	out := <-d.OutputChan
+	assert.Equal(t, "hello", string(out.Content))
+	out = <-d.OutputChan
+	assert.Equal(t, strings.Repeat("a", 10)+string(TRUNCATED), string(out.Content))
+	out = <-d.OutputChan
+	assert.Equal(t, string(TRUNCATED)+strings.Repeat("a", 5), string(out.Content))
+	d.Stop()
+}
+
+func TestDecoderTruncatesLinesSplitBeforeACharacter(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Encoding: config.ENCODING_UTF16LE, MaxMessageSize: 4}
+	d := InitializeDecoder(source)
+	d.Start()
+
+	// "aaaéb\n", 'é' straddles the limit and goes to the next line
+	d.InputChan <- NewInput([]byte{'a', 0, 'a', 0, 'a', 0, 0xe9, 0, 'b', 0, '\n', 0})
+	out := <-d.OutputChan
+	assert.Equal(t, "aaa"+string(TRUNCATED), string(out.Content))
+	assert.Equal(t, 6, out.RawDataLen)
+	out = <-d.OutputChan
+	assert.Equal(t, string(TRUNCATED)+"éb", string(out.Content))
+	assert.Equal(t, 6, out.RawDataLen)
+	d.Stop()
+}
+
+func newTruncatedLine(content string) *Line {
+	line := NewLine([]byte(content), len(content))
+	line.truncated = true
+	return line
+}
+
+func TestSingleLineHandlerSplitsLongLines(t *testing.T) {
+	outChan := make(chan *Output, 10)
+	lh := newSingleLineHandler(outChan, truncation{maxLen: 10, policy: config.TRUNCATION_POLICY_SPLIT})
+	splitMessages := expvarValue("SplitMessages")
+
+	lh.Handle(newTruncatedLine(strings.Repeat("a", 10)))
+	lh.Handle(NewLine([]byte("bbb"), 4))
+	out := <-outChan
+	assert.Equal(t, strings.Repeat("a", 10), string(out.Content))
+	out = <-outChan
+	assert.Equal(t, "bbb", string(out.Content))
+	assert.Equal(t, splitMessages+1, expvarValue("SplitMessages"))
+	lh.Stop()
+}
+
+func TestSingleLineHandlerDropsLongLines(t *testing.T) {
+	outChan := make(chan *Output, 10)
+	lh := newSingleLineHandler(outChan, truncation{maxLen: 10, policy: config.TRUNCATION_POLICY_DROP})
+	droppedMessages := expvarValue("DroppedMessages")
+
+	// the whole line is dropped, its length is added to the next output
+	lh.Handle(newTruncatedLine(strings.Repeat("a", 10)))
+	lh.Handle(newTruncatedLine(strings.Repeat("a", 10)))
+	lh.Handle(NewLine([]byte("aaa"), 4))
+	lh.Handle(NewLine([]byte("hello"), 6))
+	out := <-outChan
+	assert.Equal(t, "hello", string(out.Content))
+	assert.Equal(t, 30, out.RawDataLen)
+	assert.Equal(t, droppedMessages+1, expvarValue("DroppedMessages"))
+	lh.Stop()
+}
+
+func TestMultiLineHandlerSplitsLongContents(t *testing.T) {
+	outChan := make(chan *Output, 10)
+	rule := config.LogsProcessingRule{Reg: regexp.MustCompile("^[0-9]+\\.")}
+	lh := newMultiLineLineHandler(outChan, rule, truncation{maxLen: 10, policy: config.TRUNCATION_POLICY_SPLIT})
+
+	handleLines(lh, "1. Hello", "world", "2. Bye")
+	out := <-outChan
+	assert.Equal(t, "1. Hello\\nworld", string(out.Content))
+	assert.Equal(t, 15, out.RawDataLen)
+	lh.Stop()
+	out = <-outChan
+	assert.Equal(t, "2. Bye", string(out.Content))
+}
+
+func TestMultiLineHandlerDropsLongContents(t *testing.T) {
+	outChan := make(chan *Output, 10)
+	rule := config.LogsProcessingRule{Reg: regexp.MustCompile("^[0-9]+\\.")}
+	lh := newMultiLineLineHandler(outChan, rule, truncation{maxLen: 10, policy: config.TRUNCATION_POLICY_DROP})
+	droppedMessages := expvarValue("DroppedMessages")
+
+	// the lines of the content are dropped until the next one starts
+	handleLines(lh, "1. Hello", "world", "again", "2. Bye")
+	lh.Stop()
+	out := <-outChan
+	assert.Equal(t, "2. Bye", string(out.Content))
+	assert.Equal(t, 9+6+6+7, out.RawDataLen)
+	assert.Equal(t, droppedMessages+1, expvarValue("DroppedMessages"))
+}
+
+func expvarValue(key string) int64 {
+	if v, ok := decoderExpvars.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
 func TestSingleLineDecoderLifecycle(t *testing.T) {
 	inChan := make(chan *Input, 10)
 	outChan := make(chan *Output, 10)
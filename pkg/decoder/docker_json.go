@@ -0,0 +1,53 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+)
+
+// dockerJSONLog is one line of the log files written by the json-file logging driver of docker
+type dockerJSONLog struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time"`
+}
+
+// dockerJSONParser parses the lines of the log files written by the json-file logging driver:
+// `{"log":"<content>\n","stream":"<stdout|stderr>","time":"<timestamp>"}`
+type dockerJSONParser struct {
+	partial partialLine
+}
+
+// newDockerJSONParser returns a new dockerJSONParser joining split lines up to maxLen
+func newDockerJSONParser(maxLen int) *dockerJSONParser {
+	return &dockerJSONParser{partial: partialLine{maxLen: maxLen}}
+}
+
+// parse returns the content of line, along with its timestamp and severity.
+// Docker splits long lines, their parts don't end with '\n' and are joined with the next ones,
+// parse returns nil until the line is complete. Lines not following the format are returned as is
+func (p *dockerJSONParser) parse(line *Line) *Line {
+	var log dockerJSONLog
+	if err := json.Unmarshal(line.content, &log); err != nil || log.Stream == "" {
+		return line
+	}
+	timestamp := ""
+	if t, err := time.Parse(time.RFC3339Nano, log.Time); err == nil {
+		timestamp = t.UTC().Format(config.DateFormat)
+	}
+	severity := config.SEV_INFO
+	if log.Stream == "stderr" {
+		severity = config.SEV_ERROR
+	}
+	isPartial := !strings.HasSuffix(log.Log, "\n")
+	content := []byte(strings.TrimSuffix(log.Log, "\n"))
+	return p.partial.join(line, content, timestamp, severity, isPartial)
+}
@@ -0,0 +1,66 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDockerJSONLine(content string) *Line {
+	return NewLine([]byte(content), len(content)+1)
+}
+
+func TestDockerJSONParserParsesLines(t *testing.T) {
+	p := newDockerJSONParser(contentLenLimit)
+	line := p.parse(newDockerJSONLine(`{"log":"hello \"world\"\n","stream":"stdout","time":"2017-10-16T12:00:00.123456789+02:00"}`))
+	assert.Equal(t, `hello "world"`, string(line.content))
+	assert.Equal(t, 91, line.rawDataLen)
+	assert.Equal(t, "2017-10-16T10:00:00.123456789Z", line.timestamp)
+	assert.Equal(t, config.SEV_INFO, line.severity)
+
+	line = p.parse(newDockerJSONLine(`{"log":"error\n","stream":"stderr","time":"2017-10-16T12:00:00Z"}`))
+	assert.Equal(t, "error", string(line.content))
+	assert.Equal(t, config.SEV_ERROR, line.severity)
+}
+
+func TestDockerJSONParserJoinsPartialLines(t *testing.T) {
+	p := newDockerJSONParser(contentLenLimit)
+	assert.Nil(t, p.parse(newDockerJSONLine(`{"log":"hello ","stream":"stderr","time":"2017-10-16T12:00:00Z"}`)))
+	assert.Nil(t, p.parse(newDockerJSONLine(`{"log":"wor","stream":"stderr","time":"2017-10-16T12:00:01Z"}`)))
+	line := p.parse(newDockerJSONLine(`{"log":"ld\n","stream":"stderr","time":"2017-10-16T12:00:02Z"}`))
+	assert.Equal(t, "hello world", string(line.content))
+	assert.Equal(t, 65+62+63, line.rawDataLen)
+	assert.Equal(t, "2017-10-16T12:00:00.000000000Z", line.timestamp)
+	assert.Equal(t, config.SEV_ERROR, line.severity)
+}
+
+func TestDockerJSONParserPassesThroughOtherLines(t *testing.T) {
+	p := newDockerJSONParser(contentLenLimit)
+	for _, content := range []string{"hello world", `{"log":"hello world\n"`, `{"message":"hello world"}`} {
+		line := p.parse(newDockerJSONLine(content))
+		assert.Equal(t, content, string(line.content))
+		assert.Equal(t, "", line.timestamp)
+	}
+}
+
+func TestDecoderParsesDockerJSONLines(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, LogFormat: config.LOG_FORMAT_DOCKER}
+	d := InitializeDecoder(source)
+	d.Start()
+	d.InputChan <- NewInput([]byte(`{"log":"hello ","stream":"stdout","time":"2017-10-16T12:00:00Z"}` + "\n" + `{"log":"world\n","stream":"stdout","time":"2017-10-16T12:00:01Z"}` + "\n"))
+
+	out := <-d.OutputChan
+	assert.Equal(t, "hello world", string(out.Content))
+	assert.Equal(t, 131, out.RawDataLen)
+	assert.Equal(t, "2017-10-16T12:00:00.000000000Z", out.Timestamp)
+	assert.Equal(t, config.SEV_INFO, out.Severity)
+	d.Stop()
+	out = <-d.OutputChan
+	assert.True(t, out.ShouldStop)
+}
@@ -0,0 +1,125 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+)
+
+// byteOrderMark may start the content of files not encoded in UTF-8
+var byteOrderMark = []byte("\uFEFF")
+
+// transcoder converts data from the encoding of a source to UTF-8
+type transcoder interface {
+	// transcode returns data converted to UTF-8,
+	// the bytes of a character split between two inputs are kept for the next call
+	transcode(data []byte) []byte
+	// rawLen returns the number of bytes content, converted to UTF-8, had originally
+	rawLen(content []byte) int
+}
+
+// newTranscoder returns the transcoder of encoding,
+// or nil when data is already encoded in UTF-8
+func newTranscoder(encoding string) transcoder {
+	switch encoding {
+	case config.ENCODING_UTF16LE:
+		return &utf16Transcoder{order: binary.LittleEndian}
+	case config.ENCODING_UTF16BE:
+		return &utf16Transcoder{order: binary.BigEndian}
+	case config.ENCODING_LATIN1:
+		return &latin1Transcoder{}
+	default:
+		return nil
+	}
+}
+
+// encode converts UTF-8 content to encoding
+func encode(content []byte, encoding string) []byte {
+	switch encoding {
+	case config.ENCODING_UTF16LE, config.ENCODING_UTF16BE:
+		var order binary.ByteOrder = binary.LittleEndian
+		if encoding == config.ENCODING_UTF16BE {
+			order = binary.BigEndian
+		}
+		units := utf16.Encode([]rune(string(content)))
+		encoded := make([]byte, 2*len(units))
+		for i, unit := range units {
+			order.PutUint16(encoded[2*i:], unit)
+		}
+		return encoded
+	case config.ENCODING_LATIN1:
+		encoded := []byte{}
+		for _, r := range string(content) {
+			encoded = append(encoded, byte(r))
+		}
+		return encoded
+	default:
+		return content
+	}
+}
+
+// utf16Transcoder converts UTF-16 data to UTF-8
+type utf16Transcoder struct {
+	order   binary.ByteOrder
+	pending []byte
+}
+
+func (t *utf16Transcoder) transcode(data []byte) []byte {
+	if len(t.pending) > 0 {
+		data = append(append([]byte{}, t.pending...), data...)
+	}
+	n := len(data) &^ 1
+	units := make([]uint16, 0, n/2)
+	for i := 0; i < n; i += 2 {
+		units = append(units, t.order.Uint16(data[i:]))
+	}
+	if len(units) > 0 && isHighSurrogate(units[len(units)-1]) {
+		// the rest of the character comes with the next input
+		units = units[:len(units)-1]
+		n -= 2
+	}
+	t.pending = append([]byte{}, data[n:]...)
+	return []byte(string(utf16.Decode(units)))
+}
+
+func (t *utf16Transcoder) rawLen(content []byte) int {
+	rawLen := 0
+	for len(content) > 0 {
+		r, size := utf8.DecodeRune(content)
+		if r > 0xFFFF {
+			// encoded with a surrogate pair
+			rawLen += 4
+		} else {
+			rawLen += 2
+		}
+		content = content[size:]
+	}
+	return rawLen
+}
+
+// isHighSurrogate returns true if unit is the first half of a surrogate pair
+func isHighSurrogate(unit uint16) bool {
+	return unit >= 0xD800 && unit < 0xDC00
+}
+
+// latin1Transcoder converts ISO-8859-1 data to UTF-8
+type latin1Transcoder struct{}
+
+func (t *latin1Transcoder) transcode(data []byte) []byte {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return []byte(string(runes))
+}
+
+func (t *latin1Transcoder) rawLen(content []byte) int {
+	return utf8.RuneCount(content)
+}
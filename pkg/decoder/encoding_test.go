@@ -0,0 +1,54 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"testing"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUTF16LETranscoder(t *testing.T) {
+	tc := newTranscoder(config.ENCODING_UTF16LE)
+	assert.Equal(t, "hé", string(tc.transcode([]byte{'h', 0, 0xe9, 0})))
+	assert.Equal(t, 4, tc.rawLen([]byte("hé")))
+
+	// a character split between two inputs
+	assert.Equal(t, "h", string(tc.transcode([]byte{'h', 0, 0xe9})))
+	assert.Equal(t, "é", string(tc.transcode([]byte{0})))
+
+	// a surrogate pair split between two inputs
+	assert.Equal(t, "", string(tc.transcode([]byte{0x3d, 0xd8, 0x00})))
+	assert.Equal(t, "😀", string(tc.transcode([]byte{0xde})))
+	assert.Equal(t, 4, tc.rawLen([]byte("😀")))
+	assert.Equal(t, 2, tc.rawLen([]byte("\n")))
+}
+
+func TestUTF16BETranscoder(t *testing.T) {
+	tc := newTranscoder(config.ENCODING_UTF16BE)
+	assert.Equal(t, "hé\n", string(tc.transcode([]byte{0, 'h', 0, 0xe9, 0, '\n'})))
+	assert.Equal(t, 6, tc.rawLen([]byte("hé\n")))
+}
+
+func TestLatin1Transcoder(t *testing.T) {
+	tc := newTranscoder(config.ENCODING_LATIN1)
+	assert.Equal(t, "café", string(tc.transcode([]byte{'c', 'a', 'f', 0xe9})))
+	assert.Equal(t, 4, tc.rawLen([]byte("café")))
+	assert.Equal(t, 1, tc.rawLen([]byte("\n")))
+}
+
+func TestEncode(t *testing.T) {
+	assert.Equal(t, []byte{'\r', 0, '\n', 0}, encode([]byte("\r\n"), config.ENCODING_UTF16LE))
+	assert.Equal(t, []byte{0, 0}, encode([]byte{0}, config.ENCODING_UTF16BE))
+	assert.Equal(t, []byte{0xa7}, encode([]byte("§"), config.ENCODING_LATIN1))
+	assert.Equal(t, []byte("§"), encode([]byte("§"), ""))
+}
+
+func TestNoTranscoderForUTF8(t *testing.T) {
+	assert.Nil(t, newTranscoder(""))
+	assert.Nil(t, newTranscoder(config.ENCODING_UTF8))
+}
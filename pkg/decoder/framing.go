@@ -0,0 +1,118 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"bytes"
+	"log"
+	"strconv"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+)
+
+// maxFrameHeaderLen is the maximum number of digits of the length of a frame
+const maxFrameHeaderLen = 9
+
+// detectFraming returns the framing of data, octet counted frames
+// start with their length while delimited syslog messages start with '<'.
+// As delimited messages can start with a number too, data is octet counted
+// only when it holds a whole frame, followed by nothing, a newline or the next frame
+func detectFraming(data []byte) string {
+	i := 0
+	for i < len(data) && i < maxFrameHeaderLen && isDigit(data[i]) {
+		i++
+	}
+	if i == 0 || i == len(data) || data[i] != ' ' {
+		return ""
+	}
+	frameLen, _ := strconv.Atoi(string(data[:i]))
+	end := i + 1 + frameLen
+	if frameLen == 0 || end > len(data) {
+		return ""
+	}
+	if end < len(data) && !isDigit(data[end]) && data[end] != '\r' && data[end] != '\n' {
+		return ""
+	}
+	return config.FRAMING_OCTET_COUNTING
+}
+
+// decodeFrames splits raw data framed with octet counting, `<length> <message>`
+// as defined by RFC 6587, creates and processes a new line for each frame.
+// Frames longer than the length limit are sent in several lines
+func (d *Decoder) decodeFrames(inBuf []byte) {
+	for i := 0; i < len(inBuf); {
+		if d.frameLen > 0 {
+			n := d.frameLen
+			if n > len(inBuf)-i {
+				n = len(inBuf) - i
+			}
+			if room := d.contentLenLimit - d.lineBuffer.Len(); n > room {
+				n = room
+			}
+			d.writeLine(inBuf[i : i+n])
+			i += n
+			d.frameLen -= n
+			if d.frameLen == 0 || d.lineBuffer.Len() >= d.contentLenLimit {
+				d.sendFrame(d.frameLen > 0)
+			}
+			continue
+		}
+
+		switch c := inBuf[i]; {
+		case isDigit(c) && len(d.frameHeader) < maxFrameHeaderLen:
+			d.frameHeader = append(d.frameHeader, c)
+			i++
+		case c == ' ' && len(d.frameHeader) > 0:
+			// the header is counted in the length of the line, but is not part of its content
+			d.frameLen, _ = strconv.Atoi(string(d.frameHeader))
+			d.rawDataLen += len(d.frameHeader) + 1
+			d.frameHeader = nil
+			d.invalidFrame = false
+			i++
+		case (c == '\r' || c == '\n') && len(d.frameHeader) == 0:
+			// some senders end frames with a newline not counted in their length
+			d.rawDataLen++
+			i++
+		case d.framingDetected:
+			// the framing was guessed from the first message, the messages are delimited instead
+			log.Println("Invalid octet counting frame, delimiting the next messages instead")
+			data := append(d.frameHeader, inBuf[i:]...)
+			d.frameHeader = nil
+			d.framing = ""
+			d.decodeIncomingData(data)
+			return
+		default:
+			// the invalid data is dropped until the next frame
+			if !d.invalidFrame {
+				log.Println("Invalid octet counting frame, dropping data until the next frame")
+				d.invalidFrame = true
+			}
+			d.rawDataLen += len(d.frameHeader) + 1
+			d.frameHeader = nil
+			i++
+		}
+	}
+}
+
+// sendFrame copies the content of a frame from lineBuffer which is passed to lineHandler,
+// truncated is true when the rest of the frame is sent in the next line
+func (d *Decoder) sendFrame(truncated bool) {
+	content := make([]byte, d.lineBuffer.Len())
+	copy(content, d.lineBuffer.Bytes())
+	d.lineBuffer.Reset()
+	// some senders end frames with a newline, a frame can't span several lines once sent
+	content = bytes.TrimRight(content, "\r\n")
+	content = bytes.Replace(content, newline, escapedNewline, -1)
+	newLine := NewLine(content, d.rawDataLen)
+	newLine.truncated = truncated
+	d.rawDataLen = 0
+	d.handleLine(newLine)
+}
+
+// isDigit returns true if c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
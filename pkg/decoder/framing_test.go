@@ -0,0 +1,128 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFramingDecoder(framing string) (*Decoder, chan *Output) {
+	outChan := make(chan *Output, 10)
+	d := New(nil, outChan, NewSingleLineHandler(outChan))
+	d.framing = framing
+	return d, outChan
+}
+
+func TestDecodeFrames(t *testing.T) {
+	d, outChan := newFramingDecoder(config.FRAMING_OCTET_COUNTING)
+
+	// frames can contain newlines
+	d.decode([]byte("11 hello\nworld5 again"))
+	out := <-outChan
+	assert.Equal(t, "hello\\nworld", string(out.Content))
+	assert.Equal(t, 14, out.RawDataLen)
+	out = <-outChan
+	assert.Equal(t, "again", string(out.Content))
+	assert.Equal(t, 7, out.RawDataLen)
+
+	// frames and headers split between inputs, ending with a newline
+	d.decode([]byte("1"))
+	d.decode([]byte("2 hello"))
+	d.decode([]byte(" world\n"))
+	out = <-outChan
+	assert.Equal(t, "hello world", string(out.Content))
+	assert.Equal(t, 15, out.RawDataLen)
+}
+
+func TestDecodeFramesLongerThanTheLimit(t *testing.T) {
+	d, outChan := newFramingDecoder(config.FRAMING_OCTET_COUNTING)
+	d.contentLenLimit = 10
+
+	d.decode([]byte("15 " + strings.Repeat("a", 15)))
+	out := <-outChan
+	assert.Equal(t, strings.Repeat("a", 10)+string(TRUNCATED), string(out.Content))
+	out = <-outChan
+	assert.Equal(t, string(TRUNCATED)+strings.Repeat("a", 5), string(out.Content))
+}
+
+func TestDecodeFramesSkipsNewlinesBetweenFrames(t *testing.T) {
+	d, outChan := newFramingDecoder(config.FRAMING_OCTET_COUNTING)
+
+	d.decode([]byte("5 hello\r\n5 world\n"))
+	d.decode([]byte("\n5 again"))
+	out := <-outChan
+	assert.Equal(t, "hello", string(out.Content))
+	assert.Equal(t, 7, out.RawDataLen)
+	out = <-outChan
+	assert.Equal(t, "world", string(out.Content))
+	assert.Equal(t, 9, out.RawDataLen)
+	out = <-outChan
+	assert.Equal(t, "again", string(out.Content))
+	assert.Equal(t, 9, out.RawDataLen)
+	assert.Equal(t, config.FRAMING_OCTET_COUNTING, d.framing)
+}
+
+func TestDecodeFramesFallsBackToDelimiter(t *testing.T) {
+	d, outChan := newFramingDecoder(config.FRAMING_AUTO)
+
+	d.decode([]byte("5 hello12ab world\n"))
+	out := <-outChan
+	assert.Equal(t, "hello", string(out.Content))
+	out = <-outChan
+	assert.Equal(t, "12ab world", string(out.Content))
+	assert.Equal(t, "", d.framing)
+}
+
+func TestDecodeFramesDropsInvalidFrames(t *testing.T) {
+	d, outChan := newFramingDecoder(config.FRAMING_OCTET_COUNTING)
+
+	// with an explicit framing, invalid data is dropped until the next frame
+	d.decode([]byte("5 hello12ab world 5 again"))
+	out := <-outChan
+	assert.Equal(t, "hello", string(out.Content))
+	out = <-outChan
+	assert.Equal(t, "again", string(out.Content))
+	assert.Equal(t, 18, out.RawDataLen)
+	assert.Equal(t, config.FRAMING_OCTET_COUNTING, d.framing)
+}
+
+func TestDecodeDetectsFraming(t *testing.T) {
+	d, outChan := newFramingDecoder(config.FRAMING_AUTO)
+	d.decode([]byte("16 <13>hello\nworld\n"))
+	out := <-outChan
+	assert.Equal(t, "<13>hello\\nworld", string(out.Content))
+	assert.Equal(t, config.FRAMING_OCTET_COUNTING, d.framing)
+
+	d, outChan = newFramingDecoder(config.FRAMING_AUTO)
+	d.decode([]byte("<13>hello\nworld\n"))
+	out = <-outChan
+	assert.Equal(t, "<13>hello", string(out.Content))
+	out = <-outChan
+	assert.Equal(t, "world", string(out.Content))
+	assert.Equal(t, "", d.framing)
+
+	// delimited messages starting with a number are not mistaken for frames
+	d, outChan = newFramingDecoder(config.FRAMING_AUTO)
+	d.decode([]byte("200 OK\n404 Not Found\n"))
+	out = <-outChan
+	assert.Equal(t, "200 OK", string(out.Content))
+	assert.Equal(t, "", d.framing)
+}
+
+func TestDetectFraming(t *testing.T) {
+	assert.Equal(t, config.FRAMING_OCTET_COUNTING, detectFraming([]byte("5 hello")))
+	assert.Equal(t, config.FRAMING_OCTET_COUNTING, detectFraming([]byte("5 hello\n6 world")))
+	assert.Equal(t, config.FRAMING_OCTET_COUNTING, detectFraming([]byte("5 hello5 world")))
+	assert.Equal(t, "", detectFraming([]byte("5 hello world")))
+	assert.Equal(t, "", detectFraming([]byte("500 hello")))
+	assert.Equal(t, "", detectFraming([]byte("0 hello")))
+	assert.Equal(t, "", detectFraming([]byte("2017-10-16 hello")))
+	assert.Equal(t, "", detectFraming([]byte("<13>hello")))
+}
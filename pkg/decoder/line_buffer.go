@@ -16,6 +16,12 @@ type LineBuffer struct {
 	outputChan chan *Output
 	buffer     *bytes.Buffer
 	contentLen int
+	lines      int
+	firstLine  *Line
+	// while shouldDrop, lines are counted but their content is dropped on flush,
+	// droppedLen is then added to the next output to keep offsets right
+	shouldDrop bool
+	droppedLen int
 }
 
 // NewLineBuffer returns a new LineBuffer
@@ -37,21 +43,37 @@ func (l *LineBuffer) Length() int {
 	return l.buffer.Len()
 }
 
+// Lines returns the number of lines in buffer
+func (l *LineBuffer) Lines() int {
+	return l.lines
+}
+
 // Add stores line in buffer
 func (l *LineBuffer) Add(line *Line) {
-	l.buffer.Write(line.content)
-	l.contentLen += len(line.content) + 1 // add 1 for '\n'
+	l.AddIncompleteLine(line)
+	l.lines++
 }
 
 // AddEndOfLine stores an escaped '\n' in buffer
 func (l *LineBuffer) AddEndOfLine() {
-	l.buffer.Write([]byte(`\n`))
+	if !l.shouldDrop {
+		l.buffer.Write([]byte(`\n`))
+	}
 }
 
 // AddIncompleteLine stores a chunck of line in buff
 func (l *LineBuffer) AddIncompleteLine(line *Line) {
-	l.buffer.Write(line.content)
-	l.contentLen += len(line.content)
+	l.setFirstLine(line)
+	if !l.shouldDrop {
+		l.buffer.Write(line.content)
+	}
+	l.contentLen += line.rawDataLen
+}
+
+// Drop drops content in buffer, and the lines added until the next flush
+func (l *LineBuffer) Drop() {
+	l.shouldDrop = true
+	l.buffer.Reset()
 }
 
 // AddTruncate stores TRUNCATED in buffer
@@ -62,14 +84,30 @@ func (l *LineBuffer) AddTruncate(line *Line) {
 // send creates a new ouput from content in buffer and sends it to outputChan
 func (l *LineBuffer) Flush() {
 	defer l.reset()
+	if l.shouldDrop {
+		l.droppedLen += l.contentLen
+		return
+	}
 	content := make([]byte, l.buffer.Len())
 	copy(content, l.buffer.Bytes())
 	if len(content) > 0 {
-		output := NewOutput(content, l.contentLen)
+		output := NewOutput(content, l.droppedLen+l.contentLen)
+		l.droppedLen = 0
+		if l.firstLine != nil {
+			output.setMetadata(l.firstLine)
+		}
 		l.outputChan <- output
 	}
 }
 
+// setFirstLine keeps the first line of the content,
+// whose metadata are the ones of the output
+func (l *LineBuffer) setFirstLine(line *Line) {
+	if l.firstLine == nil {
+		l.firstLine = line
+	}
+}
+
 // Stop forwards stop event to outputChan
 func (l *LineBuffer) Stop() {
 	l.outputChan <- newStopOutput()
@@ -78,5 +116,8 @@ func (l *LineBuffer) Stop() {
 // reset prepares buffer to receive new lines
 func (l *LineBuffer) reset() {
 	l.contentLen = 0
+	l.lines = 0
+	l.firstLine = nil
+	l.shouldDrop = false
 	l.buffer.Reset()
 }
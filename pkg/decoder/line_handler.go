@@ -6,23 +6,62 @@
 package decoder
 
 import (
+	"expvar"
 	"regexp"
 	"sync"
 	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
 )
 
 // TRUNCATED is the warning we add at the beginning or/and at the end of a truncated message
 var TRUNCATED = []byte("...TRUNCATED...")
 
-// Line represents content separated by two '\n'
+// decoderExpvars counts the messages affected by the truncation policies:
+// TruncatedMessages and SplitMessages count the times a message reached the limit,
+// DroppedMessages counts the messages dropped
+var decoderExpvars = expvar.NewMap("decoder")
+
+// truncation holds the maximum length of the content of messages
+// and the policy applied to longer messages
+type truncation struct {
+	maxLen int
+	policy string
+}
+
+// defaultTruncation truncates the messages longer than contentLenLimit
+func defaultTruncation() truncation {
+	return truncation{maxLen: contentLenLimit, policy: config.TRUNCATION_POLICY_TRUNCATE}
+}
+
+// newTruncation returns the truncation of source, using the defaults for the settings not set
+func newTruncation(source *config.IntegrationConfigLogSource) truncation {
+	t := defaultTruncation()
+	if source.MaxMessageSize > 0 {
+		t.maxLen = source.MaxMessageSize
+	}
+	if source.TruncationPolicy != "" {
+		t.policy = source.TruncationPolicy
+	}
+	return t
+}
+
+// Line represents content separated by two '\n',
+// truncated is true when the rest of the content is in the next line
 type Line struct {
-	content []byte
+	content    []byte
+	rawDataLen int
+	timestamp  string
+	severity   []byte
+	truncated  bool
 }
 
-// NewLine returns a new Line
-func NewLine(content []byte) *Line {
+// NewLine returns a new Line, rawDataLen is the number of bytes
+// of the line and its '\n' as they were read
+func NewLine(content []byte, rawDataLen int) *Line {
 	return &Line{
-		content: content,
+		content:    content,
+		rawDataLen: rawDataLen,
 	}
 }
 
@@ -36,15 +75,25 @@ type LineHandler interface {
 type SingleLineHandler struct {
 	lineChan       chan *Line
 	outputChan     chan *Output
+	truncation     truncation
 	shouldTruncate bool
+	shouldDrop     bool
+	// the length of the lines dropped, added to the next output to keep offsets right
+	droppedRawDataLen int
 }
 
 // NewSingleLineHandler returns a new SingleLineHandler
 func NewSingleLineHandler(outputChan chan *Output) *SingleLineHandler {
+	return newSingleLineHandler(outputChan, defaultTruncation())
+}
+
+// newSingleLineHandler returns a new SingleLineHandler applying truncation to long lines
+func newSingleLineHandler(outputChan chan *Output, t truncation) *SingleLineHandler {
 	lineChan := make(chan *Line)
 	lineHandler := SingleLineHandler{
 		lineChan:   lineChan,
 		outputChan: outputChan,
+		truncation: t,
 	}
 	go lineHandler.start()
 	return &lineHandler
@@ -69,34 +118,58 @@ func (lh *SingleLineHandler) start() {
 }
 
 // process creates outputs from lines and forwards them to outputChan
-// When lines are too long, they are truncated
+// When lines are too long, they are truncated, split or dropped
 func (lh *SingleLineHandler) process(line *Line) {
 	lineLen := len(line.content)
 	if lineLen == 0 {
 		return
 	}
+	// a line is split by the decoder when it reaches the limit
+	isTooLong := line.truncated
 
-	var content []byte
-	if lh.shouldTruncate {
-		// add TRUNCATED at the beginning of content
-		content = append(TRUNCATED, line.content...)
-		lh.shouldTruncate = false
-	} else {
-		// keep content the same
-		content = line.content
+	switch lh.truncation.policy {
+	case config.TRUNCATION_POLICY_DROP:
+		if isTooLong || lh.shouldDrop {
+			if !lh.shouldDrop {
+				decoderExpvars.Add("DroppedMessages", 1)
+			}
+			lh.droppedRawDataLen += line.rawDataLen
+			// the rest of the line is dropped too
+			lh.shouldDrop = isTooLong
+			return
+		}
+		lh.send(line.content, line)
+	case config.TRUNCATION_POLICY_SPLIT:
+		if isTooLong {
+			decoderExpvars.Add("SplitMessages", 1)
+		}
+		lh.send(line.content, line)
+	default:
+		var content []byte
+		if lh.shouldTruncate {
+			// add TRUNCATED at the beginning of content
+			content = append(TRUNCATED, line.content...)
+			lh.shouldTruncate = false
+		} else {
+			// keep content the same
+			content = line.content
+		}
+		if isTooLong {
+			// add TRUNCATED at the end of content
+			decoderExpvars.Add("TruncatedMessages", 1)
+			content = append(content, TRUNCATED...)
+			lh.shouldTruncate = true
+		}
+		lh.send(content, line)
 	}
+}
 
-	if lineLen < contentLenLimit {
-		// send content
-		output := NewOutput(content, lineLen+1) // add 1 to take into account '\n'
-		lh.outputChan <- output
-	} else {
-		// add TRUNCATED at the end of content and send it
-		content := append(content, TRUNCATED...)
-		output := NewOutput(content, lineLen)
-		lh.outputChan <- output
-		lh.shouldTruncate = true
-	}
+// send forwards content to outputChan with the metadata of line
+func (lh *SingleLineHandler) send(content []byte, line *Line) {
+	output := NewOutput(content, lh.droppedRawDataLen+line.rawDataLen)
+	output.setMetadata(line)
+	lh.droppedRawDataLen = 0
+	lh.outputChan <- output
 }
 
 // flushTimeout represents the time we want to wait before flushing lineBuffer
@@ -104,25 +177,56 @@ func (lh *SingleLineHandler) process(line *Line) {
 const flushTimeout = 1 * time.Second
 
 // MultiLineLineHandler reads lines from lineChan and uses lineBuffer to send them
-// when a new line matches with re or flushTimer is fired
+// when a new line matches with re, when the last line of a content is found,
+// when enough lines were received or when flushTimer is fired.
+// With match, re matches the lines appended to the previous line or prepended to the next one,
+// or the other lines with negate, as in Filebeat
 type MultiLineLineHandler struct {
 	lineChan     chan *Line
 	lineBuffer   *LineBuffer
 	newContentRe *regexp.Regexp
+	endContentRe *regexp.Regexp
+	negate       bool
+	match        string
+	maxLines     int
+	truncation   truncation
+	flushTimeout time.Duration
 	flushTimer   *time.Timer
 	mu           sync.Mutex
 	shouldStop   bool
 }
 
 // NewMultiLineLineHandler returns a new MultiLineLineHandler
+// starting a new content on each line matching newContentRe
 func NewMultiLineLineHandler(outputChan chan *Output, newContentRe *regexp.Regexp) *MultiLineLineHandler {
+	return NewMultiLineLineHandlerFromRule(outputChan, config.LogsProcessingRule{Reg: newContentRe})
+}
+
+// NewMultiLineLineHandlerFromRule returns a new MultiLineLineHandler configured by a multi_line rule
+func NewMultiLineLineHandlerFromRule(outputChan chan *Output, rule config.LogsProcessingRule) *MultiLineLineHandler {
+	return newMultiLineLineHandler(outputChan, rule, defaultTruncation())
+}
+
+// newMultiLineLineHandler returns a new MultiLineLineHandler configured by a multi_line rule,
+// applying truncation to long contents
+func newMultiLineLineHandler(outputChan chan *Output, rule config.LogsProcessingRule, t truncation) *MultiLineLineHandler {
 	lineChan := make(chan *Line)
 	lineBuffer := NewLineBuffer(outputChan)
-	flushTimer := time.NewTimer(flushTimeout)
+	timeout := flushTimeout
+	if rule.FlushTimeout > 0 {
+		timeout = time.Duration(rule.FlushTimeout) * time.Second
+	}
+	flushTimer := time.NewTimer(timeout)
 	lineHandler := MultiLineLineHandler{
 		lineChan:     lineChan,
 		lineBuffer:   lineBuffer,
-		newContentRe: newContentRe,
+		newContentRe: rule.Reg,
+		endContentRe: rule.EndReg,
+		negate:       rule.Negate,
+		match:        rule.Match,
+		maxLines:     rule.MaxLines,
+		truncation:   t,
+		flushTimeout: timeout,
 		flushTimer:   flushTimer,
 	}
 	go lineHandler.start()
@@ -140,7 +244,7 @@ func (lh *MultiLineLineHandler) Stop() {
 	close(lh.lineChan)
 	lh.shouldStop = true
 	// assure to stop timer goroutine
-	lh.flushTimer.Reset(flushTimeout)
+	lh.resetFlushTimer()
 	lh.mu.Unlock()
 }
 
@@ -159,11 +263,21 @@ func (lh *MultiLineLineHandler) run() {
 		lh.flushTimer.Stop()
 		lh.process(line)
 		// restart timer if no more lines are received
-		lh.flushTimer.Reset(flushTimeout)
+		lh.resetFlushTimer()
 		lh.mu.Unlock()
 	}
 }
 
+// resetFlushTimer restarts flushTimer, without waiting
+// longer than the default timeout once stopped
+func (lh *MultiLineLineHandler) resetFlushTimer() {
+	if lh.shouldStop && lh.flushTimeout > flushTimeout {
+		lh.flushTimer.Reset(flushTimeout)
+	} else {
+		lh.flushTimer.Reset(lh.flushTimeout)
+	}
+}
+
 // handleExpiration flushes content in lineBuffer when flushTimer expires
 func (lh *MultiLineLineHandler) handleExpiration() {
 	for range lh.flushTimer.C {
@@ -177,10 +291,23 @@ func (lh *MultiLineLineHandler) handleExpiration() {
 	lh.lineBuffer.Stop()
 }
 
-// process accumulates lines in lineBuffer and flushes lineBuffer when a new line matches with newContentRe
-// When lines are too long, they are truncated
+// process accumulates lines in lineBuffer and flushes lineBuffer when a new line matches with newContentRe,
+// or once the last line of a content or the maximum number of lines is added
+// When contents are too long, they are truncated, split or dropped
 func (lh *MultiLineLineHandler) process(line *Line) {
-	if lh.newContentRe.Match(line.content) {
+	matches := lh.newContentRe != nil && lh.newContentRe.Match(line.content)
+	isFirstLine, isLastLine := false, false
+	switch lh.match {
+	case config.MULTILINE_MATCH_AFTER:
+		// the lines not appended to the previous line start a new content
+		isFirstLine = lh.newContentRe != nil && matches == lh.negate
+	case config.MULTILINE_MATCH_BEFORE:
+		// the lines not prepended to the next line end the content
+		isLastLine = lh.newContentRe != nil && matches == lh.negate
+	default:
+		isFirstLine = matches
+	}
+	if isFirstLine {
 		// send content in lineBuffer
 		lh.lineBuffer.Flush()
 	}
@@ -188,15 +315,34 @@ func (lh *MultiLineLineHandler) process(line *Line) {
 		// add '\n' to content in lineBuffer
 		lh.lineBuffer.AddEndOfLine()
 	}
-	if len(line.content)+lh.lineBuffer.Length() < contentLenLimit {
+	if !line.truncated && len(line.content)+lh.lineBuffer.Length() < lh.truncation.maxLen {
 		// add line to content in lineBuffer
 		lh.lineBuffer.Add(line)
 	} else {
-		// add line and truncate and flush content in lineBuffer
 		lh.lineBuffer.AddIncompleteLine(line)
-		lh.lineBuffer.AddTruncate(line)
+		switch lh.truncation.policy {
+		case config.TRUNCATION_POLICY_DROP:
+			// drop content in lineBuffer and the next lines until the content is complete
+			decoderExpvars.Add("DroppedMessages", 1)
+			lh.lineBuffer.Drop()
+		case config.TRUNCATION_POLICY_SPLIT:
+			// flush content in lineBuffer, the next lines go to a new content
+			decoderExpvars.Add("SplitMessages", 1)
+			lh.lineBuffer.Flush()
+		default:
+			// truncate and flush content in lineBuffer
+			decoderExpvars.Add("TruncatedMessages", 1)
+			lh.lineBuffer.AddTruncate(line)
+			lh.lineBuffer.Flush()
+			// truncate next content
+			lh.lineBuffer.AddTruncate(line)
+		}
+		return
+	}
+	if lh.endContentRe != nil && lh.endContentRe.Match(line.content) {
+		isLastLine = true
+	}
+	if isLastLine || (lh.maxLines > 0 && lh.lineBuffer.Lines() >= lh.maxLines) {
 		lh.lineBuffer.Flush()
-		// truncate next content
-		lh.lineBuffer.AddTruncate(line)
 	}
 }
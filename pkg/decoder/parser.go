@@ -0,0 +1,58 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package decoder
+
+import (
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+)
+
+// lineParser extracts the content, the timestamp and the severity
+// of the lines written in the log format of a source
+type lineParser interface {
+	// parse returns line without its envelope, or nil when the line continues on the next one
+	parse(line *Line) *Line
+}
+
+// newLineParser returns the parser of logFormat, joining split lines up to maxLen,
+// or nil when the lines have no envelope to remove
+func newLineParser(logFormat string, maxLen int) lineParser {
+	switch logFormat {
+	case config.LOG_FORMAT_CRI:
+		return newCRIParser(maxLen)
+	case config.LOG_FORMAT_DOCKER:
+		return newDockerJSONParser(maxLen)
+	default:
+		return nil
+	}
+}
+
+// partialLine joins the lines split by a container runtime,
+// the complete line has the timestamp and severity of its first part
+type partialLine struct {
+	line   *Line
+	maxLen int
+}
+
+// join adds content to the line being joined and returns the complete line,
+// or nil when more parts are expected and maxLen is not reached
+func (p *partialLine) join(line *Line, content []byte, timestamp string, severity []byte, isPartial bool) *Line {
+	if p.line != nil {
+		p.line.content = append(p.line.content, content...)
+		p.line.rawDataLen += line.rawDataLen
+	} else {
+		p.line = NewLine(content, line.rawDataLen)
+		p.line.timestamp = timestamp
+		p.line.severity = severity
+	}
+	if isPartial && len(p.line.content) < p.maxLen {
+		return nil
+	}
+	// the rest of the line is in the next parts
+	p.line.truncated = isPartial || line.truncated
+	completeLine := p.line
+	p.line = nil
+	return completeLine
+}
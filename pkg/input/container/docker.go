@@ -77,9 +77,9 @@ func (dt *DockerTailer) Stop() {
 }
 
 // tailFromBegining starts the tailing from the beginning
-// of the container logs
+// of the container logs, docker returns all of them without `Since`
 func (dt *DockerTailer) tailFromBegining() error {
-	return dt.tailFrom(time.Time{}.Format(config.DateFormat))
+	return dt.tailFrom("")
 }
 
 // tailFromEnd starts the tailing from the last line
@@ -88,10 +88,26 @@ func (dt *DockerTailer) tailFromEnd() error {
 	return dt.tailFrom(time.Now().UTC().Format(config.DateFormat))
 }
 
-// recoverTailing starts the tailing from the last log line processed, or now
-// if we see this container for the first time
+// recoverTailing starts the tailing from the last log line processed, or from
+// the start position of the source if we see this container for the first time
 func (dt *DockerTailer) recoverTailing(a *auditor.Auditor) error {
-	return dt.tailFrom(dt.nextLogSinceDate(a.GetLastCommitedTimestamp(dt.Identifier())))
+	lastTs := a.GetLastCommitedTimestamp(dt.Identifier())
+	if lastTs == "" {
+		return dt.tailFrom(dt.startPosition())
+	}
+	return dt.tailFrom(dt.nextLogSinceDate(lastTs))
+}
+
+// startPosition returns the `from` value for a container
+// whose logs were never collected
+func (dt *DockerTailer) startPosition() string {
+	switch dt.source.StartPosition {
+	case config.START_POSITION_END:
+		return time.Now().UTC().Format(config.DateFormat)
+	default:
+		// without `Since`, docker returns all the logs of the container
+		return ""
+	}
 }
 
 // nextLogSinceDate returns the `from` value of the next log line
@@ -223,8 +239,13 @@ func (dt *DockerTailer) checkForNewDockerTags() {
 }
 
 func (dt *DockerTailer) buildTagsPayload() []byte {
-	tagsString := fmt.Sprintf("%s,%s", strings.Join(dt.containerTags, ","), dt.source.Tags)
-	return config.BuildTagsPayload(tagsString, dt.source.Source, dt.source.SourceCategory)
+	return buildTagsPayload(dt.containerTags, dt.source)
+}
+
+// buildTagsPayload returns the tags payload of the logs of a container
+func buildTagsPayload(containerTags []string, source *config.IntegrationConfigLogSource) []byte {
+	tagsString := fmt.Sprintf("%s,%s", strings.Join(containerTags, ","), source.Tags)
+	return config.BuildTagsPayload(tagsString, source.Source, source.SourceCategory)
 }
 
 // parseMessage extracts the date and the severity from the raw docker message
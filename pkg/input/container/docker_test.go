@@ -8,6 +8,7 @@ package container
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/DataDog/datadog-log-agent/pkg/config"
 	"github.com/stretchr/testify/suite"
@@ -61,6 +62,19 @@ func (suite *DockerTailerTestSuite) TestDockerTailerNextLogSinceDate() {
 	suite.Equal("", suite.tailer.nextLogSinceDate(""))
 }
 
+func (suite *DockerTailerTestSuite) TestDockerTailerStartPosition() {
+	suite.tailer.source = &config.IntegrationConfigLogSource{}
+	suite.Equal("", suite.tailer.startPosition())
+
+	suite.tailer.source.StartPosition = config.START_POSITION_BEGINNING
+	suite.Equal("", suite.tailer.startPosition())
+
+	suite.tailer.source.StartPosition = config.START_POSITION_END
+	since, err := time.Parse(config.DateFormat, suite.tailer.startPosition())
+	suite.Nil(err)
+	suite.True(time.Since(since) < time.Minute)
+}
+
 func (suite *DockerTailerTestSuite) TestDockerTailerIdentifier() {
 	suite.tailer.containerId = "test"
 	suite.Equal("docker:test", suite.tailer.Identifier())
@@ -6,15 +6,19 @@
 package container
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/DataDog/datadog-agent/pkg/tagger"
+	dockerutil "github.com/DataDog/datadog-agent/pkg/util/docker"
 
 	"github.com/DataDog/datadog-log-agent/pkg/auditor"
 	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/DataDog/datadog-log-agent/pkg/input/tailer"
 	"github.com/DataDog/datadog-log-agent/pkg/message"
 	"github.com/DataDog/datadog-log-agent/pkg/pipeline"
 	"github.com/docker/docker/api/types"
@@ -24,6 +28,9 @@ import (
 const scanPeriod = 10 * time.Second
 const DOCKER_API_VERSION = "1.25"
 
+// jsonFileLogDriver is the logging driver whose log files can be tailed from disk
+const jsonFileLogDriver = "json-file"
+
 // A ContainerInput listens for stdout and stderr of containers
 type ContainerInput struct {
 	pp      *pipeline.PipelineProvider
@@ -31,10 +38,15 @@ type ContainerInput struct {
 	tailers map[string]*DockerTailer
 	cli     *client.Client
 	auditor *auditor.Auditor
+
+	// the json-file logs of the containers of the sources reading from disk
+	// are tailed by fileScanner, through one file source per container
+	fileScanner *tailer.Scanner
+	fileSources map[string]*config.IntegrationConfigLogSource
 }
 
-// New returns an initialized ContainerInput
-func New(sources []*config.IntegrationConfigLogSource, pp *pipeline.PipelineProvider, a *auditor.Auditor) *ContainerInput {
+// New returns an initialized ContainerInput, the files read from disk count in openFiles
+func New(sources []*config.IntegrationConfigLogSource, pp *pipeline.PipelineProvider, a *auditor.Auditor, openFiles *tailer.OpenFilesCounter) *ContainerInput {
 
 	containerSources := []*config.IntegrationConfigLogSource{}
 	for _, source := range sources {
@@ -45,12 +57,20 @@ func New(sources []*config.IntegrationConfigLogSource, pp *pipeline.PipelineProv
 		}
 	}
 
-	return &ContainerInput{
-		pp:      pp,
-		sources: containerSources,
-		tailers: make(map[string]*DockerTailer),
-		auditor: a,
+	c := &ContainerInput{
+		pp:          pp,
+		sources:     containerSources,
+		tailers:     make(map[string]*DockerTailer),
+		auditor:     a,
+		fileSources: make(map[string]*config.IntegrationConfigLogSource),
 	}
+	for _, source := range containerSources {
+		if source.ReadFromDisk {
+			c.fileScanner = tailer.New(nil, pp, a, openFiles)
+			break
+		}
+	}
+	return c
 }
 
 // Start starts the ContainerInput
@@ -82,6 +102,15 @@ func (c *ContainerInput) scan(tailFromBegining bool) {
 			if c.sourceShouldMonitorContainer(source, container) {
 				containersToMonitor[container.ID] = true
 
+				if fileSource, isTailed := c.fileSources[container.ID]; isTailed {
+					// the tags of a container can change while it's running
+					c.refreshFileSourceTags(container.ID, fileSource)
+					continue
+				}
+				if _, isTailed := c.tailers[container.ID]; !isTailed && source.ReadFromDisk && c.setupFileTailing(container, source) {
+					continue
+				}
+
 				tailer, isTailed := c.tailers[container.ID]
 				if isTailed && tailer.shouldStop {
 					c.stopTailer(tailer)
@@ -101,6 +130,13 @@ func (c *ContainerInput) scan(tailFromBegining bool) {
 			c.stopTailer(tailer)
 		}
 	}
+	for containerId, fileSource := range c.fileSources {
+		if !containersToMonitor[containerId] {
+			log.Println("Stop tailing container", c.HumanReadableContainerId(containerId))
+			c.fileScanner.RemoveSource(fileSource)
+			delete(c.fileSources, containerId)
+		}
+	}
 }
 
 func (c *ContainerInput) stopTailer(tailer *DockerTailer) {
@@ -155,15 +191,22 @@ func (c *ContainerInput) setup() error {
 
 	// Start tailing monitored containers
 	c.scan(false)
+
+	// the files of the containers found are tailed like the files existing at start,
+	// from where they were left or from their start position
+	if c.fileScanner != nil {
+		c.fileScanner.Start()
+	}
 	return nil
 }
 
-// setupTailer sets one tailer, making it tail from the begining or the end
+// setupTailer sets one tailer, making it tail from the begining or the end.
+// The start position of the source, if any, prevails for containers never tailed
 func (c *ContainerInput) setupTailer(cli *client.Client, container types.Container, source *config.IntegrationConfigLogSource, tailFromBegining bool, outputChan chan message.Message) {
 	log.Println("Detected container", container.Image, "-", c.HumanReadableContainerId(container.ID))
 	t := NewDockerTailer(cli, container, source, outputChan)
 	var err error
-	if tailFromBegining {
+	if tailFromBegining && source.StartPosition == "" {
 		err = t.tailFromBegining()
 	} else {
 		err = t.recoverTailing(c.auditor)
@@ -174,11 +217,82 @@ func (c *ContainerInput) setupTailer(cli *client.Client, container types.Contain
 	c.tailers[container.ID] = t
 }
 
+// setupFileTailing lets fileScanner tail the json-file logs of container from disk,
+// it returns false when they can't be read and the API must be used instead
+func (c *ContainerInput) setupFileTailing(container types.Container, source *config.IntegrationConfigLogSource) bool {
+	info, err := c.cli.ContainerInspect(context.Background(), container.ID)
+	if err != nil {
+		log.Println("Can't inspect container", c.HumanReadableContainerId(container.ID), err)
+		return false
+	}
+	logPath := jsonFileLogPath(info)
+	if logPath == "" {
+		log.Println("Can't read logs of container", c.HumanReadableContainerId(container.ID), "from disk, its logging driver is not", jsonFileLogDriver)
+		return false
+	}
+	if _, err := os.Stat(logPath); err != nil {
+		log.Println("Can't read logs of container", c.HumanReadableContainerId(container.ID), "from disk,", err)
+		return false
+	}
+
+	log.Println("Detected container", container.Image, "-", c.HumanReadableContainerId(container.ID), "reading its logs from", logPath)
+	containerTags, err := tagger.Tag(dockerutil.ContainerIDToEntityName(container.ID), true)
+	if err != nil {
+		log.Println(err)
+	}
+	fileSource := newFileSource(source, logPath, containerTags)
+	c.fileScanner.AddSource(fileSource)
+	c.fileSources[container.ID] = fileSource
+	return true
+}
+
+// refreshFileSourceTags updates the tags of the logs of a container read from disk,
+// as a DockerTailer does for the logs read from the API
+func (c *ContainerInput) refreshFileSourceTags(containerId string, fileSource *config.IntegrationConfigLogSource) {
+	containerTags, err := tagger.Tag(dockerutil.ContainerIDToEntityName(containerId), true)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	updateTagsPayload(fileSource, containerTags)
+}
+
+// updateTagsPayload sets the tags payload of the file source of a container
+// when the tags of the container changed
+func updateTagsPayload(fileSource *config.IntegrationConfigLogSource, containerTags []string) {
+	if tagsPayload := buildTagsPayload(containerTags, fileSource); !bytes.Equal(tagsPayload, fileSource.TagsPayload) {
+		fileSource.TagsPayload = tagsPayload
+	}
+}
+
+// jsonFileLogPath returns the path of the logs of a container
+// using the json-file logging driver, or an empty string
+func jsonFileLogPath(info types.ContainerJSON) string {
+	if info.ContainerJSONBase == nil || info.HostConfig == nil || info.HostConfig.LogConfig.Type != jsonFileLogDriver {
+		return ""
+	}
+	return info.LogPath
+}
+
+// newFileSource returns the file source tailing the json-file logs of a container
+// with the rules of its docker source
+func newFileSource(source *config.IntegrationConfigLogSource, logPath string, containerTags []string) *config.IntegrationConfigLogSource {
+	fileSource := *source
+	fileSource.Type = config.FILE_TYPE
+	fileSource.Path = logPath
+	fileSource.LogFormat = config.LOG_FORMAT_DOCKER
+	fileSource.TagsPayload = buildTagsPayload(containerTags, source)
+	return &fileSource
+}
+
 // Stop stops the ContainerInput and its tailers
 func (c *ContainerInput) Stop() {
 	for _, t := range c.tailers {
 		t.Stop()
 	}
+	if c.fileScanner != nil {
+		c.fileScanner.Stop()
+	}
 }
 
 func (c *ContainerInput) HumanReadableContainerId(containerId string) string {
@@ -11,6 +11,7 @@ import (
 	"github.com/DataDog/datadog-log-agent/pkg/config"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -43,6 +44,30 @@ func (suite *ContainerScannerTestSuite) TestContainerScannerFilter() {
 	suite.True(suite.c.sourceShouldMonitorContainer(cfg, container))
 }
 
+func (suite *ContainerScannerTestSuite) TestJSONFileLogPath() {
+	logPath := "/var/lib/docker/containers/abc/abc-json.log"
+	info := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{LogPath: logPath, HostConfig: &container.HostConfig{LogConfig: container.LogConfig{Type: "json-file"}}}}
+	suite.Equal(logPath, jsonFileLogPath(info))
+
+	info.HostConfig.LogConfig.Type = "journald"
+	suite.Equal("", jsonFileLogPath(info))
+	suite.Equal("", jsonFileLogPath(types.ContainerJSON{}))
+}
+
+func (suite *ContainerScannerTestSuite) TestNewFileSource() {
+	source := &config.IntegrationConfigLogSource{Type: config.DOCKER_TYPE, Image: "myapp", ReadFromDisk: true, Source: "nginx", Tags: "env:prod"}
+	fileSource := newFileSource(source, "/var/lib/docker/containers/abc/abc-json.log", []string{"image_name:myapp"})
+	suite.Equal(config.FILE_TYPE, fileSource.Type)
+	suite.Equal("/var/lib/docker/containers/abc/abc-json.log", fileSource.Path)
+	suite.Equal(config.LOG_FORMAT_DOCKER, fileSource.LogFormat)
+	suite.Equal(`[dd ddsource="nginx"][dd ddtags="image_name:myapp,env:prod"]`, string(fileSource.TagsPayload))
+	suite.Equal(config.DOCKER_TYPE, source.Type)
+
+	// the tags of the container changed
+	updateTagsPayload(fileSource, []string{"image_name:myapp", "version:2"})
+	suite.Equal(`[dd ddsource="nginx"][dd ddtags="image_name:myapp,version:2,env:prod"]`, string(fileSource.TagsPayload))
+}
+
 func TestContainerScannerTestSuite(t *testing.T) {
 	suite.Run(t, new(ContainerScannerTestSuite))
 }
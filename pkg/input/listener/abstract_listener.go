@@ -16,11 +16,12 @@ import (
 	"github.com/DataDog/datadog-log-agent/pkg/pipeline"
 )
 
-// A NetworkListener implements the methods run and readMessages,
+// A NetworkListener implements the methods run, readMessages and stop,
 // required by the AbstractNetworkListener to run properly
 type NetworkListener interface {
 	run()
 	readMessage(net.Conn, []byte) (int, error)
+	stop()
 }
 
 // AbstractNetworkListener is an abstracted network listener.
@@ -36,6 +37,11 @@ func (anl *AbstractNetworkListener) Start() {
 	go anl.listener.run()
 }
 
+// Stop stops the AbstractNetworkListener from receiving messages
+func (anl *AbstractNetworkListener) Stop() {
+	anl.listener.stop()
+}
+
 // forwardMessages lets the AbstractNetworkListener forward log messages to the output channel
 func (anl *AbstractNetworkListener) forwardMessages(d *decoder.Decoder, outputChan chan message.Message) {
 	for output := range d.OutputChan {
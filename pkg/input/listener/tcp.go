@@ -56,3 +56,8 @@ func (tcpListener *TcpListener) run() {
 func (tcpListener *TcpListener) readMessage(conn net.Conn, inBuf []byte) (int, error) {
 	return conn.Read(inBuf)
 }
+
+// stop stops the listener from accepting new connections
+func (tcpListener *TcpListener) stop() {
+	tcpListener.listener.Close()
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/DataDog/datadog-log-agent/pkg/config"
 	"github.com/DataDog/datadog-log-agent/pkg/message"
 	"github.com/DataDog/datadog-log-agent/pkg/pipeline"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -38,9 +39,14 @@ func (suite *TCPTestSuite) SetupTest() {
 	suite.tcpl.Start()
 }
 
+func (suite *TCPTestSuite) TearDownTest() {
+	suite.tcpl.Stop()
+}
+
 func (suite *TCPTestSuite) TestTCPReceivesMessages() {
 	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", TCP_TEST_PORT))
 	suite.Nil(err)
+	defer conn.Close()
 	fmt.Fprintf(conn, "hello world\n")
 	msg := <-suite.outputChan
 	suite.Equal("hello world", string(msg.Content()))
@@ -49,3 +55,23 @@ func (suite *TCPTestSuite) TestTCPReceivesMessages() {
 func TestTCPTestSuite(t *testing.T) {
 	suite.Run(t, new(TCPTestSuite))
 }
+
+func TestTCPReceivesOctetCountedMessages(t *testing.T) {
+	pp := pipeline.NewPipelineProvider()
+	pp.MockPipelineChans()
+	outputChan := pp.NextPipelineChan()
+	source := &config.IntegrationConfigLogSource{Type: config.TCP_TYPE, Port: TCP_TEST_PORT + 1, Framing: config.FRAMING_OCTET_COUNTING}
+	tcpl, err := NewTcpListener(pp, source)
+	assert.Nil(t, err)
+	tcpl.Start()
+	defer tcpl.Stop()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", TCP_TEST_PORT+1))
+	assert.Nil(t, err)
+	defer conn.Close()
+	fmt.Fprintf(conn, "11 hello\nworld5 again")
+	msg := <-outputChan
+	assert.Equal(t, "hello\\nworld", string(msg.Content()))
+	msg = <-outputChan
+	assert.Equal(t, "again", string(msg.Content()))
+}
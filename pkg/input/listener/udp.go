@@ -56,3 +56,8 @@ func (udpListener *UdpListener) readMessage(conn net.Conn, inBuf []byte) (int, e
 	n, _, err := udpListener.conn.ReadFromUDP(inBuf)
 	return n, err
 }
+
+// stop stops the listener from receiving messages
+func (udpListener *UdpListener) stop() {
+	udpListener.conn.Close()
+}
@@ -0,0 +1,42 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package tailer
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+)
+
+const (
+	gzipExtension  = ".gz"
+	bzip2Extension = ".bz2"
+)
+
+// isCompressed returns true if the file at path is compressed,
+// which is the case of most rotated files
+func isCompressed(path string) bool {
+	switch filepath.Ext(path) {
+	case gzipExtension, bzip2Extension:
+		return true
+	default:
+		return false
+	}
+}
+
+// newDecompressor returns a reader decompressing the content
+// of the file at path, read from r
+func newDecompressor(path string, r io.Reader) (io.Reader, error) {
+	switch filepath.Ext(path) {
+	case gzipExtension:
+		return gzip.NewReader(r)
+	case bzip2Extension:
+		return bzip2.NewReader(r), nil
+	default:
+		return r, nil
+	}
+}
@@ -0,0 +1,81 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package tailer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCompressed(t *testing.T) {
+	assert.True(t, isCompressed("/var/log/app.log.1.gz"))
+	assert.True(t, isCompressed("/var/log/app.log.1.bz2"))
+	assert.False(t, isCompressed("/var/log/app.log"))
+	assert.False(t, isCompressed("/var/log/app.log.1"))
+}
+
+func TestNewDecompressor(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte("hello world\n"))
+	w.Close()
+	r, err := newDecompressor("app.log.1.gz", &buf)
+	assert.Nil(t, err)
+	content, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world\n", string(content))
+
+	// "hello world\n" compressed with bzip2
+	bz2, _ := hex.DecodeString("425a68393141592653594eece83600000251800010400006449080200031064c4101a7a9a580bb9431f8bb9229c28482776741b0")
+	r, err = newDecompressor("app.log.1.bz2", bytes.NewReader(bz2))
+	assert.Nil(t, err)
+	content, err = ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world\n", string(content))
+
+	_, err = newDecompressor("app.log.1.gz", bytes.NewReader([]byte("hello world\n")))
+	assert.NotNil(t, err)
+}
+
+func TestComputeCompressedFingerprint(t *testing.T) {
+	path := "tests/compressed.log.1.gz"
+	os.MkdirAll("tests", os.ModePerm)
+	defer os.Remove(path)
+	writeGzipFile := func(content string) {
+		f, err := os.Create(path)
+		assert.Nil(t, err)
+		w := gzip.NewWriter(f)
+		w.Write([]byte(content))
+		w.Close()
+		f.Close()
+	}
+
+	// the fingerprint of the decompressed content
+	content := strings.Repeat("a", fingerprintLength) + "\n"
+	writeGzipFile(content)
+	assert.Nil(t, ioutil.WriteFile("tests/compressed.log", []byte(content), 0644))
+	defer os.Remove("tests/compressed.log")
+	assert.NotEqual(t, "", computeCompressedFingerprint(path))
+	assert.Equal(t, computeFingerprintForPath("tests/compressed.log"), computeCompressedFingerprint(path))
+
+	// small files are identified by all their content
+	writeGzipFile("hello world\n")
+	fingerprint := computeCompressedFingerprint(path)
+	assert.NotEqual(t, "", fingerprint)
+	writeGzipFile("hello again\n")
+	assert.NotEqual(t, fingerprint, computeCompressedFingerprint(path))
+
+	// a file being compressed can't be identified yet
+	assert.Nil(t, ioutil.WriteFile(path, []byte{0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff}, 0644))
+	assert.Equal(t, "", computeCompressedFingerprint(path))
+}
@@ -0,0 +1,69 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package tailer
+
+import (
+	"fmt"
+	"hash/crc64"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// fingerprintLength is the number of bytes at the begining of a file
+// used to identify it
+const fingerprintLength = 1024
+
+var fingerprintTable = crc64.MakeTable(crc64.ECMA)
+
+// computeFingerprint returns a checksum of the first bytes of a file,
+// which identifies the file regardless of its path or inode.
+// It returns an empty string while the file is too small to be identified:
+// the offset of a file smaller than fingerprintLength is only recovered under its path,
+// not once the file is renamed
+func computeFingerprint(f *os.File) string {
+	if f == nil {
+		return ""
+	}
+	buf := make([]byte, fingerprintLength)
+	n, _ := f.ReadAt(buf, 0)
+	if n < fingerprintLength {
+		return ""
+	}
+	return fmt.Sprintf("%016x", crc64.Checksum(buf, fingerprintTable))
+}
+
+// computeFingerprintForPath returns the fingerprint of the file at path
+func computeFingerprintForPath(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return computeFingerprint(f)
+}
+
+// computeCompressedFingerprint returns the fingerprint of the decompressed content
+// of the compressed file at path, which is the fingerprint the file had before it was compressed.
+// As the content of a compressed file doesn't change, a file too small to be identified
+// is identified by a checksum of all its content
+func computeCompressedFingerprint(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	r, err := newDecompressor(path, f)
+	if err != nil {
+		return ""
+	}
+	// a file being compressed fails with an unexpected EOF
+	buf, err := ioutil.ReadAll(io.LimitReader(r, fingerprintLength))
+	if err != nil || len(buf) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%016x", crc64.Checksum(buf, fingerprintTable))
+}
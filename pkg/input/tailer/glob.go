@@ -0,0 +1,141 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package tailer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// recursiveWildcard matches zero or more directories in a path pattern
+const recursiveWildcard = "**"
+
+// containsWildcard returns true if path is a pattern rather than a literal path
+func containsWildcard(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// globFiles returns the sorted list of regular files matching pattern.
+// On top of the filepath.Match syntax, a `**` path element
+// matches zero or more directories
+func globFiles(pattern string) []string {
+	var matches []string
+	if !strings.Contains(pattern, recursiveWildcard) {
+		matches, _ = filepath.Glob(pattern)
+	} else {
+		matches = globRecursive(pattern)
+	}
+
+	files := []string{}
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, match)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// globRecursive walks the longest literal directory of pattern,
+// and returns the paths matching pattern
+func globRecursive(pattern string) []string {
+	patternElements := splitPath(pattern)
+	matches := []string{}
+	filepath.Walk(patternRoot(pattern), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// skip directories we can't read
+			return nil
+		}
+		if !info.IsDir() && matchElements(patternElements, splitPath(path)) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	return matches
+}
+
+// isExcluded returns true if path matches one of the exclude patterns.
+// Patterns without a separator match the name of the file,
+// the others match the path of the file or of one of its directories
+func isExcluded(path string, excludePaths []string) bool {
+	pathElements := splitPath(path)
+	for _, pattern := range excludePaths {
+		if !strings.ContainsRune(pattern, filepath.Separator) {
+			if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+				return true
+			}
+			continue
+		}
+		patternElements := splitPath(pattern)
+		for i := len(pathElements); i > 0; i-- {
+			if matchElements(patternElements, pathElements[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// patternRoot returns the longest directory of pattern without wildcards,
+// which is the directory of the file for a literal path
+func patternRoot(pattern string) string {
+	patternElements := splitPath(pattern)
+	rootLength := len(patternElements) - 1
+	for i, element := range patternElements {
+		if containsWildcard(element) {
+			rootLength = i
+			break
+		}
+	}
+	root := ""
+	if rootLength > 0 {
+		root = filepath.Join(patternElements[:rootLength]...)
+	}
+	if filepath.IsAbs(pattern) {
+		root = string(filepath.Separator) + root
+	}
+	if root == "" {
+		root = "."
+	}
+	return root
+}
+
+// matchElements returns true if all path elements match the pattern elements
+func matchElements(patternElements, pathElements []string) bool {
+	if len(patternElements) == 0 {
+		return len(pathElements) == 0
+	}
+	if patternElements[0] == recursiveWildcard {
+		// `**` either matches no element, or consumes one and keeps matching
+		if matchElements(patternElements[1:], pathElements) {
+			return true
+		}
+		return len(pathElements) > 0 && matchElements(patternElements, pathElements[1:])
+	}
+	if len(pathElements) == 0 {
+		return false
+	}
+	matched, err := filepath.Match(patternElements[0], pathElements[0])
+	if err != nil || !matched {
+		return false
+	}
+	return matchElements(patternElements[1:], pathElements[1:])
+}
+
+// splitPath returns the non empty elements of a path
+func splitPath(path string) []string {
+	elements := []string{}
+	for _, element := range strings.Split(filepath.Clean(path), string(filepath.Separator)) {
+		if element != "" && element != "." {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
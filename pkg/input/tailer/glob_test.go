@@ -0,0 +1,72 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package tailer
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainsWildcard(t *testing.T) {
+	assert.False(t, containsWildcard("/var/log/app.log"))
+	assert.True(t, containsWildcard("/var/log/*.log"))
+	assert.True(t, containsWildcard("/var/log/app-?.log"))
+	assert.True(t, containsWildcard("/var/log/app-[0-9].log"))
+	assert.True(t, containsWildcard("/var/log/**/app.log"))
+}
+
+func TestMatchElements(t *testing.T) {
+	assert.True(t, matchElements(splitPath("/var/log/*.log"), splitPath("/var/log/app.log")))
+	assert.False(t, matchElements(splitPath("/var/log/*.log"), splitPath("/var/log/app/app.log")))
+	assert.True(t, matchElements(splitPath("/var/log/**/*.log"), splitPath("/var/log/app.log")))
+	assert.True(t, matchElements(splitPath("/var/log/**/*.log"), splitPath("/var/log/app/app.log")))
+	assert.True(t, matchElements(splitPath("/var/log/**/*.log"), splitPath("/var/log/app/1/app.log")))
+	assert.False(t, matchElements(splitPath("/var/log/**/*.log"), splitPath("/var/log/app/app.txt")))
+	assert.True(t, matchElements(splitPath("/var/**/app/*.log"), splitPath("/var/log/app/app.log")))
+	assert.False(t, matchElements(splitPath("/var/**/app/*.log"), splitPath("/var/log/other/app.log")))
+}
+
+func TestGlobFiles(t *testing.T) {
+	testDir := "tests/glob"
+	os.RemoveAll(testDir)
+	os.MkdirAll(testDir+"/app/1", os.ModePerm)
+	defer os.RemoveAll(testDir)
+	for _, path := range []string{"a.log", "b.log", "c.txt", "app/d.log", "app/1/e.log"} {
+		f, err := os.Create(testDir + "/" + path)
+		assert.Nil(t, err)
+		f.Close()
+	}
+
+	assert.Equal(t, []string{"tests/glob/a.log", "tests/glob/b.log"}, globFiles(testDir+"/*.log"))
+	assert.Equal(t, []string{"tests/glob/app/d.log"}, globFiles(testDir+"/*/*.log"))
+	assert.Equal(t, []string{"tests/glob/a.log", "tests/glob/app/1/e.log", "tests/glob/app/d.log", "tests/glob/b.log"}, globFiles(testDir+"/**/*.log"))
+	assert.Equal(t, []string{"tests/glob/app/1/e.log"}, globFiles(testDir+"/**/1/*.log"))
+	assert.Equal(t, []string{}, globFiles(testDir+"/*.csv"))
+}
+
+func TestIsExcluded(t *testing.T) {
+	excludePaths := []string{"*.gz", "debug-*.log", "/var/log/app/archive", "/var/log/**/tmp/*.log"}
+	assert.False(t, isExcluded("/var/log/app/app.log", excludePaths))
+	assert.True(t, isExcluded("/var/log/app/app.log.1.gz", excludePaths))
+	assert.True(t, isExcluded("/var/log/app/debug-1.log", excludePaths))
+	assert.True(t, isExcluded("/var/log/app/archive/app.log", excludePaths))
+	assert.True(t, isExcluded("/var/log/app/archive/2017/app.log", excludePaths))
+	assert.False(t, isExcluded("/var/log/app/archived.log", excludePaths))
+	assert.True(t, isExcluded("/var/log/app/tmp/app.log", excludePaths))
+	assert.False(t, isExcluded("/var/log/app/tmp/app.txt", excludePaths))
+	assert.False(t, isExcluded("/var/log/app/app.log", nil))
+}
+
+func TestPatternRoot(t *testing.T) {
+	assert.Equal(t, "/var/log", patternRoot("/var/log/app.log"))
+	assert.Equal(t, "/var/log", patternRoot("/var/log/*.log"))
+	assert.Equal(t, "/var/log", patternRoot("/var/log/**/app.log"))
+	assert.Equal(t, "/var", patternRoot("/var/*/app.log"))
+	assert.Equal(t, "tests/glob", patternRoot("tests/glob/*.log"))
+	assert.Equal(t, ".", patternRoot("*.log"))
+}
@@ -0,0 +1,52 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package tailer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// findRotatedFile returns the path where the content of a rotated file can
+// still be read, or an empty string if it can't be found in the directory of
+// the file, rotated files moved to another directory are not found.
+// When a file is rotated by renaming it, the rotated file keeps its inode.
+// When a file is copied then truncated, the copy keeps its fingerprint,
+// only the copies named after the file are fingerprinted, as app.log.1 or app-20170101.log for app.log
+func findRotatedFile(path string, fileInode uint64, fingerprint string) string {
+	dir := filepath.Dir(path)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	base := filepath.Base(path)
+	prefix := strings.TrimSuffix(base, filepath.Ext(base))
+	candidates := []string{}
+	for _, f := range files {
+		candidate := filepath.Join(dir, f.Name())
+		if !f.Mode().IsRegular() || candidate == filepath.Clean(path) {
+			continue
+		}
+		if fileInode != 0 && inode(f) == fileInode {
+			return candidate
+		}
+		if strings.HasPrefix(f.Name(), prefix) && f.Size() >= fingerprintLength {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	if fingerprint == "" {
+		return ""
+	}
+	for _, candidate := range candidates {
+		if computeFingerprintForPath(candidate) == fingerprint {
+			return candidate
+		}
+	}
+	return ""
+}
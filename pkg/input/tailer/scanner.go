@@ -6,8 +6,11 @@
 package tailer
 
 import (
+	"expvar"
 	"log"
 	"os"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,15 +22,29 @@ import (
 
 const scanPeriod = 10 * time.Second
 
+var tailerExpvars = expvar.NewMap("tailer")
+
 type Scanner struct {
-	sources []*config.IntegrationConfigLogSource
-	pp      *pipeline.PipelineProvider
-	tailers map[string]*Tailer
-	auditor *auditor.Auditor
+	sources           []*config.IntegrationConfigLogSource
+	sourcesMutex      sync.Mutex
+	pp                *pipeline.PipelineProvider
+	tailers           map[string]*Tailer
+	rotatedTailers    map[string]*Tailer
+	compressedTailers map[string]*Tailer
+	deletedTailers    map[string]*Tailer
+	closedFiles       map[string]*closedFile
+	openFilesLimit    int
+	openFiles         *OpenFilesCounter
+	inactiveTimeout   time.Duration
+	auditor           *auditor.Auditor
+	watcher           Watcher
+	done              chan struct{}
+	running           sync.WaitGroup
 }
 
-// New returns an initialized Scanner
-func New(sources []*config.IntegrationConfigLogSource, pp *pipeline.PipelineProvider, auditor *auditor.Auditor) *Scanner {
+// New returns an initialized Scanner, counting its open files in openFiles
+// shared with the other scanners of the agent
+func New(sources []*config.IntegrationConfigLogSource, pp *pipeline.PipelineProvider, auditor *auditor.Auditor, openFiles *OpenFilesCounter) *Scanner {
 	tailSources := []*config.IntegrationConfigLogSource{}
 	for _, source := range sources {
 		switch source.Type {
@@ -37,54 +54,170 @@ func New(sources []*config.IntegrationConfigLogSource, pp *pipeline.PipelineProv
 		}
 	}
 	return &Scanner{
-		sources: tailSources,
-		pp:      pp,
-		tailers: make(map[string]*Tailer),
-		auditor: auditor,
+		sources:           tailSources,
+		pp:                pp,
+		tailers:           make(map[string]*Tailer),
+		rotatedTailers:    make(map[string]*Tailer),
+		compressedTailers: make(map[string]*Tailer),
+		deletedTailers:    make(map[string]*Tailer),
+		closedFiles:       make(map[string]*closedFile),
+		openFilesLimit:    config.LogsAgent.GetInt("open_files_limit"),
+		openFiles:         openFiles,
+		inactiveTimeout:   time.Duration(config.LogsAgent.GetInt("inactive_file_timeout")) * time.Second,
+		auditor:           auditor,
+		watcher:           NewWatcher(),
+		done:              make(chan struct{}),
 	}
 }
 
-// setup sets all tailers
+// setup sets all tailers, opening the most recently modified files
+// within the limit of open files
 func (s *Scanner) setup() {
-	for _, source := range s.sources {
-		if _, ok := s.tailers[source.Path]; ok {
-			log.Println("Can't tail file twice:", source.Path)
-		} else {
-			s.setupTailer(source, false, s.pp.NextPipelineChan())
+	for _, source := range s.getSources() {
+		for _, path := range s.filesToTail(source) {
+			if isCompressed(path) {
+				s.readCompressedFile(source, path)
+				continue
+			}
+			if _, ok := s.closedFiles[path]; ok {
+				log.Println("Can't tail file twice:", path)
+			} else {
+				// a file created after the start is a new file, tailed from the begining
+				stat, err := os.Stat(path)
+				if err != nil {
+					s.closedFiles[path] = &closedFile{source: source, tailFromBegining: source.StartPosition == ""}
+				} else {
+					s.closedFiles[path] = &closedFile{source: source, size: stat.Size()}
+				}
+			}
 		}
 	}
+	s.schedule()
 }
 
-// setupTailer sets one tailer, making it tail from the begining or the end
-func (s *Scanner) setupTailer(source *config.IntegrationConfigLogSource, tailFromBegining bool, outputChan chan message.Message) {
-	t := NewTailer(outputChan, source)
-	var err error
-	if tailFromBegining {
-		err = t.tailFromBegining()
-	} else {
-		// resume tailing from last commited offset
-		err = t.recoverTailing(s.auditor)
+// AddSource adds a file source to tail, its files are tailed from the next scan
+func (s *Scanner) AddSource(source *config.IntegrationConfigLogSource) {
+	s.sourcesMutex.Lock()
+	defer s.sourcesMutex.Unlock()
+	s.sources = append(s.sources, source)
+}
+
+// RemoveSource removes a source, its files stop being tailed on the next scan
+func (s *Scanner) RemoveSource(source *config.IntegrationConfigLogSource) {
+	s.sourcesMutex.Lock()
+	defer s.sourcesMutex.Unlock()
+	for i, src := range s.sources {
+		if src == source {
+			s.sources = append(s.sources[:i:i], s.sources[i+1:]...)
+			return
+		}
+	}
+}
+
+// getSources returns a copy of the sources,
+// which can be added and removed while they are scanned
+func (s *Scanner) getSources() []*config.IntegrationConfigLogSource {
+	s.sourcesMutex.Lock()
+	defer s.sourcesMutex.Unlock()
+	return append([]*config.IntegrationConfigLogSource{}, s.sources...)
+}
+
+// filesToTail returns the paths of the files matching the path of source,
+// which can be a literal path or a glob pattern, and none of its exclude paths
+func (s *Scanner) filesToTail(source *config.IntegrationConfigLogSource) []string {
+	paths := []string{source.Path}
+	if containsWildcard(source.Path) {
+		paths = globFiles(source.Path)
+	}
+	if len(source.ExcludePaths) == 0 {
+		return paths
 	}
+	files := []string{}
+	for _, path := range paths {
+		if !isExcluded(path, source.ExcludePaths) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// setupTailer sets one tailer, making it tail a new file from the begining
+func (s *Scanner) setupTailer(source *config.IntegrationConfigLogSource, path string, outputChan chan message.Message) {
+	s.startTailer(NewTailer(outputChan, source, path), 0, os.SEEK_SET)
+}
+
+// startTailer lets a tailer tail its file from offset
+func (s *Scanner) startTailer(t *Tailer, offset int64, whence int) {
+	t.watch(s.watcher)
+	err := t.tailFrom(offset, whence)
 	if err != nil {
 		log.Println(err)
 	}
-	s.tailers[source.Path] = t
+	s.tailers[t.path] = t
+}
+
+// readCompressedFile reads a compressed file once if its source allows it,
+// to backfill the logs that were rotated while the agent was down
+func (s *Scanner) readCompressedFile(source *config.IntegrationConfigLogSource, path string) {
+	if !source.ReadCompressed {
+		return
+	}
+	if tailer, isRead := s.compressedTailers[path]; isRead {
+		if tailer.isCompleted() {
+			if !tailer.hasForwarded() && !s.auditor.IsCompleted(tailer.Identifier()) {
+				// the file was read entirely before it was compressed
+				s.auditor.CompleteEntry(tailer.Identifier(), tailer.getDecodedOffset(), tailer.Fingerprint())
+			}
+			// keep track of the file as long as it exists so that it's never read again
+			s.auditor.RefreshEntry(tailer.Identifier())
+		}
+		if !tailer.isDone() || tailer.isCompleted() {
+			return
+		}
+		// the file could not be read entirely, try again
+	}
+	t := NewTailer(s.pp.NextPipelineChan(), source, path)
+	err := t.readCompressed(s.auditor)
+	if err != nil {
+		log.Println(err)
+	}
+	s.compressedTailers[path] = t
 }
 
 // Start starts the Scanner
 func (s *Scanner) Start() {
+	s.watchSources()
 	s.setup()
+	s.running.Add(1)
 	go s.run()
 }
 
-// run lets the Scanner tail its file
+// run lets the Scanner tail its file,
+// scanning periodically or as soon as watched directories change, until it's stopped
 func (s *Scanner) run() {
+	defer s.running.Done()
 	ticker := time.NewTicker(scanPeriod)
-	for _ = range ticker.C {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.watcher.DirEvents():
+		}
 		s.scan()
 	}
 }
 
+// watchSources lets the watcher report the files created,
+// renamed or removed in the directories of the sources,
+// including their subdirectories for `**` patterns
+func (s *Scanner) watchSources() {
+	for _, source := range s.getSources() {
+		s.watcher.WatchDir(patternRoot(source.Path), strings.Contains(source.Path, recursiveWildcard))
+	}
+}
+
 // scan checks all the files we're expected to tail,
 // compares them to the currently tailed files,
 // and triggeres the required updates.
@@ -92,45 +225,237 @@ func (s *Scanner) run() {
 // its tailer will keep tailing the rotated file.
 // The Scanner needs to stop that previous tailer,
 // and start a new one for the new file.
+// New files matching a pattern are tailed from the begining,
+// and files that don't match anymore stop being tailed.
 func (s *Scanner) scan() {
-	for _, source := range s.sources {
-		tailer := s.tailers[source.Path]
-		f, err := os.Open(source.Path)
-		if err != nil {
-			continue
+	// directories missing so far may have been created
+	s.watchSources()
+
+	for path, tailer := range s.rotatedTailers {
+		if tailer.isDone() {
+			delete(s.rotatedTailers, path)
 		}
-		stat1, err := f.Stat()
-		if err != nil {
-			continue
+	}
+	s.cleanupDeletedFiles()
+
+	filesTailed := make(map[string]bool)
+	for _, source := range s.getSources() {
+		for _, path := range s.filesToTail(source) {
+			if filesTailed[path] {
+				// file already matched by a previous source
+				continue
+			}
+			filesTailed[path] = true
+			if isCompressed(path) {
+				s.readCompressedFile(source, path)
+				continue
+			}
+			if _, isDrained := s.rotatedTailers[path]; isDrained {
+				continue
+			}
+			if _, isClosed := s.closedFiles[path]; isClosed {
+				continue
+			}
+
+			tailer, isTailed := s.tailers[path]
+			if !isTailed {
+				// a new file is tailed from the begining, unless it was already tailed
+				// under its path or another name, or its source has a start position
+				_, whence := s.auditor.GetLastCommitedOffset(fileIdentifier(path))
+				tailFromBegining := source.StartPosition == "" && whence == os.SEEK_END &&
+					s.auditor.GetIdentifierForFingerprint(computeFingerprintForPath(path)) == ""
+				file := &closedFile{source: source, tailFromBegining: tailFromBegining}
+				if stat, err := os.Stat(path); err == nil {
+					file.size = stat.Size()
+				}
+				s.closedFiles[path] = file
+				continue
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				if os.IsNotExist(err) && isDeleted(tailer.file) {
+					s.onFileDeletion(path, tailer)
+				}
+				continue
+			}
+			stat1, err := f.Stat()
+			fingerprint := computeFingerprint(f)
+			f.Close()
+			if err != nil {
+				continue
+			}
+			stat2, err := tailer.file.Stat()
+			if err != nil {
+				s.onFileRotation(tailer, source)
+				continue
+			}
+			if inode(stat1) != inode(stat2) {
+				s.onFileRotation(tailer, source)
+				continue
+			}
+
+			if stat1.Size() < tailer.GetReadOffset() {
+				s.onFileRotation(tailer, source)
+				continue
+			}
+
+			// the begining of the file changed, it was truncated and written again
+			if fingerprint != "" && tailer.Fingerprint() != "" && fingerprint != tailer.Fingerprint() {
+				s.onFileRotation(tailer, source)
+			}
 		}
-		stat2, err := tailer.file.Stat()
-		if err != nil {
-			s.onFileRotation(tailer, source)
-			continue
+	}
+
+	for path, tailer := range s.tailers {
+		if !filesTailed[path] {
+			if isDeleted(tailer.file) {
+				s.onFileDeletion(path, tailer)
+			} else {
+				s.stopTailer(path, tailer)
+			}
 		}
-		if inode(stat1) != inode(stat2) {
-			s.onFileRotation(tailer, source)
-			continue
+	}
+	for path, tailer := range s.compressedTailers {
+		if !filesTailed[path] {
+			tailer.Stop(true)
+			delete(s.compressedTailers, path)
 		}
-
-		if stat1.Size() < tailer.GetReadOffset() {
-			s.onFileRotation(tailer, source)
+	}
+	for path := range s.closedFiles {
+		if !filesTailed[path] {
+			delete(s.closedFiles, path)
 		}
 	}
+
+	s.schedule()
 }
 
+// onFileRotation replaces the tailer of a rotated file by a new tailer,
+// reading the new file from the begining
 func (s *Scanner) onFileRotation(tailer *Tailer, source *config.IntegrationConfigLogSource) {
+	rotatedPath := findRotatedFile(tailer.path, fileInode(tailer.file), tailer.Fingerprint())
+	if rotatedPath != "" {
+		s.drainRotatedFile(tailer, source, rotatedPath)
+	} else {
+		// the rotated file can't be found, let the tailer read what it can
+		shouldTrackOffset := false
+		tailer.Stop(shouldTrackOffset)
+	}
+	s.setupTailer(source, tailer.path, tailer.outputChan)
+}
+
+// drainRotatedFile stops the tailer of a rotated file, and starts a tailer
+// reading the rotated file from where the first one stopped until EOF,
+// keeping track of its offset under the identifier of the rotated file
+func (s *Scanner) drainRotatedFile(tailer *Tailer, source *config.IntegrationConfigLogSource, rotatedPath string) {
+	log.Println("Draining", rotatedPath, "rotated from", tailer.path)
+	rotatedTailer := NewTailer(tailer.outputChan, source, rotatedPath)
+	rotatedTailer.watch(s.watcher)
+	s.rotatedTailers[rotatedPath] = rotatedTailer
+	go func() {
+		offset := tailer.stopNow()
+		err := rotatedTailer.drainFrom(offset)
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+// onFileDeletion lets the tailer of a deleted file read what is left in the file,
+// which remains possible as long as it's open, then close it before the close timeout
+// so that its disk space is freed.
+// The offset of the file is not tracked anymore as the file won't come back
+func (s *Scanner) onFileDeletion(path string, tailer *Tailer) {
+	log.Println(path, "was deleted")
+	tailerExpvars.Add("DeletedFiles", 1)
 	shouldTrackOffset := false
 	tailer.Stop(shouldTrackOffset)
-	s.setupTailer(source, true, tailer.outputChan)
+	delete(s.tailers, path)
+	s.deletedTailers[path] = tailer
+}
+
+// cleanupDeletedFiles forgets the deleted files whose tailer stopped
+func (s *Scanner) cleanupDeletedFiles() {
+	for path, tailer := range s.deletedTailers {
+		if !tailer.isDone() {
+			continue
+		}
+		if tailer.isCompleted() {
+			tailerExpvars.Add("DeletedFilesDrained", 1)
+		} else {
+			log.Println("Closed", path, "before the end of the deleted file was read")
+			tailerExpvars.Add("DeletedFilesTimedOut", 1)
+		}
+		if _, isTailed := s.tailers[path]; !isTailed {
+			s.auditor.RemoveEntry(tailer.Identifier())
+		}
+		delete(s.deletedTailers, path)
+	}
+}
+
+// stopTailer stops tailing a file that does not match its source anymore
+func (s *Scanner) stopTailer(path string, tailer *Tailer) {
+	log.Println("Stop tailing", path)
+	shouldTrackOffset := true
+	tailer.Stop(shouldTrackOffset)
+	delete(s.tailers, path)
 }
 
 // Stop stops the Scanner and its tailers
 func (s *Scanner) Stop() {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	// wait for the scan in progress, which can start new tailers
+	s.running.Wait()
 	shouldTrackOffset := true
 	for _, t := range s.tailers {
 		t.Stop(shouldTrackOffset)
 	}
+	for _, t := range s.rotatedTailers {
+		t.Stop(shouldTrackOffset)
+	}
+	for _, t := range s.compressedTailers {
+		t.Stop(shouldTrackOffset)
+	}
+	for _, t := range s.deletedTailers {
+		t.Stop(false)
+	}
+	s.openFiles.remove(s)
+	s.watcher.Stop()
+}
+
+// fileInode returns the inode of an open file
+func fileInode(f *os.File) uint64 {
+	if f == nil {
+		return 0
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	return inode(stat)
+}
+
+// isDeleted returns true if an open file was removed from the filesystem,
+// which is the case when no path links to it anymore
+func isDeleted(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	switch s := stat.Sys().(type) {
+	case *syscall.Stat_t:
+		return s.Nlink == 0
+	default:
+		return false
+	}
 }
 
 // inode uniquely identifies a file on a filesystem
@@ -6,8 +6,13 @@
 package tailer
 
 import (
+	"compress/gzip"
+	"expvar"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -51,7 +56,7 @@ func (suite *ScannerTestSuite) SetupTest() {
 	suite.testRotatedFile = f
 
 	suite.sources = []*config.IntegrationConfigLogSource{&config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: suite.testPath}}
-	suite.s = New(suite.sources, suite.pp, auditor.New(nil))
+	suite.s = New(suite.sources, suite.pp, auditor.New(nil), NewOpenFilesCounter())
 	suite.s.setup()
 	for _, tl := range suite.s.tailers {
 		tl.sleepMutex.Lock()
@@ -163,6 +168,527 @@ func (suite *ScannerTestSuite) TestScannerScanWithLogRotationCopyTruncate() {
 	suite.Equal(int64(6), newTailer.GetReadOffset())
 }
 
+func (suite *ScannerTestSuite) TestScannerScanWithContentChange() {
+	s := suite.s
+	sources := suite.sources
+
+	var tailer *Tailer
+	var newTailer *Tailer
+	var err error
+	var msg message.Message
+
+	tailer = s.tailers[sources[0].Path]
+	_, err = suite.testFile.WriteString(strings.Repeat("a", fingerprintLength) + "\n")
+	suite.Nil(err)
+	msg = <-suite.outputChan
+	suite.Equal(strings.Repeat("a", fingerprintLength), string(msg.Content()))
+	suite.NotEqual("", tailer.Fingerprint())
+
+	// the file is truncated and written again beyond the read offset before we scan it
+	suite.testFile.Truncate(0)
+	suite.testFile.Seek(0, 0)
+	_, err = suite.testFile.WriteString(strings.Repeat("b", 2*fingerprintLength) + "\n")
+	suite.Nil(err)
+	s.scan()
+	newTailer = s.tailers[sources[0].Path]
+	suite.True(tailer != newTailer)
+	suite.NotEqual(tailer.Fingerprint(), newTailer.Fingerprint())
+}
+
+// receiveContents returns the sorted contents of the next n messages
+func (suite *ScannerTestSuite) receiveContents(n int) []string {
+	contents := []string{}
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-suite.outputChan:
+			contents = append(contents, string(msg.Content()))
+		case <-time.After(5 * time.Second):
+			suite.Fail("Timeout while waiting for messages")
+			return contents
+		}
+	}
+	sort.Strings(contents)
+	return contents
+}
+
+// waitForReadOffset waits for a tailer to account for all the data it read
+func (suite *ScannerTestSuite) waitForReadOffset(tailer *Tailer, offset int64) {
+	for i := 0; i < 100 && tailer.GetReadOffset() < offset; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	suite.Equal(offset, tailer.GetReadOffset())
+}
+
+// waitUntilDone waits for a tailer to forward all its messages and stop
+func (suite *ScannerTestSuite) waitUntilDone(tailer *Tailer) {
+	select {
+	case <-tailer.done:
+	case <-time.After(5 * time.Second):
+		suite.Fail("Timeout while waiting for the tailer to stop")
+	}
+}
+
+func (suite *ScannerTestSuite) TestScannerDrainsFileRotatedWithRename() {
+	s := suite.s
+
+	_, err := suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	msg := <-suite.outputChan
+	suite.Equal("hello world", string(msg.Content()))
+	suite.waitForReadOffset(s.tailers[suite.testPath], int64(len("hello world\n")))
+
+	// lines written right before the rotation are not read yet
+	_, err = suite.testFile.WriteString("line 1\nline 2\n")
+	suite.Nil(err)
+	os.Rename(suite.testPath, suite.testRotatedPath)
+	f, err := os.Create(suite.testPath)
+	suite.Nil(err)
+	s.scan()
+
+	rotatedTailer := s.rotatedTailers[suite.testRotatedPath]
+	suite.NotNil(rotatedTailer)
+	suite.Equal("file:tests/scanner/scanner.log.1", rotatedTailer.Identifier())
+
+	_, err = f.WriteString("hello again\n")
+	suite.Nil(err)
+	suite.Equal([]string{"hello again", "line 1", "line 2"}, suite.receiveContents(3))
+
+	// the rotated file was read until EOF, and no line was sent twice
+	suite.waitUntilDone(rotatedTailer)
+	suite.Equal(int64(len("hello world\nline 1\nline 2\n")), rotatedTailer.getDecodedOffset())
+	s.scan()
+	suite.Equal(0, len(s.rotatedTailers))
+}
+
+func (suite *ScannerTestSuite) TestScannerDrainsFileRotatedWithCopyTruncate() {
+	s := suite.s
+
+	header := strings.Repeat("a", fingerprintLength)
+	_, err := suite.testFile.WriteString(header + "\n")
+	suite.Nil(err)
+	msg := <-suite.outputChan
+	suite.Equal(header, string(msg.Content()))
+	suite.waitForReadOffset(s.tailers[suite.testPath], int64(len(header)+1))
+
+	// lines written right before the rotation are not read yet
+	_, err = suite.testFile.WriteString("line 1\nline 2\n")
+	suite.Nil(err)
+	content, err := ioutil.ReadFile(suite.testPath)
+	suite.Nil(err)
+	suite.Nil(ioutil.WriteFile(suite.testRotatedPath, content, 0644))
+	suite.testFile.Truncate(0)
+	suite.testFile.Seek(0, 0)
+	s.scan()
+
+	rotatedTailer := s.rotatedTailers[suite.testRotatedPath]
+	suite.NotNil(rotatedTailer)
+
+	_, err = suite.testFile.WriteString("hello again\n")
+	suite.Nil(err)
+	suite.Equal([]string{"hello again", "line 1", "line 2"}, suite.receiveContents(3))
+
+	// the copy was read until EOF, and no line was sent twice
+	suite.waitUntilDone(rotatedTailer)
+	suite.Equal(int64(len(content)), rotatedTailer.getDecodedOffset())
+}
+
+func (suite *ScannerTestSuite) TestFindRotatedFile() {
+	tailer := suite.s.tailers[suite.sources[0].Path]
+	suite.Equal("", findRotatedFile(suite.testPath, fileInode(tailer.file), ""))
+
+	// the file was renamed
+	os.Rename(suite.testPath, suite.testRotatedPath)
+	suite.Equal(suite.testRotatedPath, findRotatedFile(suite.testPath, fileInode(tailer.file), ""))
+
+	// the file was copied
+	os.Remove(suite.testRotatedPath)
+	suite.Equal("", findRotatedFile(suite.testPath, fileInode(tailer.file), "abc"))
+	copyPath := fmt.Sprintf("%s.copy", suite.testPath)
+	suite.Nil(ioutil.WriteFile(copyPath, []byte(strings.Repeat("a", fingerprintLength)), 0644))
+	defer os.Remove(copyPath)
+	suite.Equal(copyPath, findRotatedFile(suite.testPath, fileInode(tailer.file), computeFingerprintForPath(copyPath)))
+
+	// copies named after another file are not fingerprinted
+	otherPath := fmt.Sprintf("%s/other.log.1", suite.testDir)
+	suite.Nil(os.Rename(copyPath, otherPath))
+	defer os.Remove(otherPath)
+	suite.Equal("", findRotatedFile(suite.testPath, fileInode(tailer.file), computeFingerprintForPath(otherPath)))
+}
+
+func (suite *ScannerTestSuite) TestScannerScanWithGlobPattern() {
+	globDir := fmt.Sprintf("%s/glob", suite.testDir)
+	os.RemoveAll(globDir)
+	os.MkdirAll(globDir, os.ModePerm)
+	defer os.RemoveAll(globDir)
+
+	firstPath := fmt.Sprintf("%s/first.log", globDir)
+	secondPath := fmt.Sprintf("%s/second.log", globDir)
+	_, err := os.Create(firstPath)
+	suite.Nil(err)
+
+	sources := []*config.IntegrationConfigLogSource{&config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: fmt.Sprintf("%s/*.log", globDir)}}
+	s := New(sources, suite.pp, auditor.New(nil), NewOpenFilesCounter())
+	defer s.Stop()
+	s.setup()
+	suite.Equal(1, len(s.tailers))
+	suite.NotNil(s.tailers[firstPath])
+
+	// a new file matching the pattern is tailed from the begining
+	f, err := os.Create(secondPath)
+	suite.Nil(err)
+	_, err = f.WriteString("hello world\n")
+	suite.Nil(err)
+	s.scan()
+	suite.Equal(2, len(s.tailers))
+	msg := <-suite.outputChan
+	suite.Equal("hello world", string(msg.Content()))
+
+	// a file that disappears is not tailed anymore
+	f.Close()
+	os.Remove(secondPath)
+	s.scan()
+	suite.Equal(1, len(s.tailers))
+	suite.Nil(s.tailers[secondPath])
+}
+
+func (suite *ScannerTestSuite) TestScannerRecoversOffsetOfNewFiles() {
+	globDir := fmt.Sprintf("%s/recover", suite.testDir)
+	os.RemoveAll(globDir)
+	os.MkdirAll(globDir, os.ModePerm)
+	defer os.RemoveAll(globDir)
+	knownPath := fmt.Sprintf("%s/known.log", globDir)
+	newPath := fmt.Sprintf("%s/new.log", globDir)
+
+	// the registry of the previous run knows the offset of a small file
+	runPath, err := ioutil.TempDir("", "scanner")
+	suite.Nil(err)
+	defer os.RemoveAll(runPath)
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	registry := fmt.Sprintf(`{"Version":1,"Registry":{"file:%s":{"Offset":12,"LastUpdated":"%s"}}}`, knownPath, now)
+	suite.Nil(ioutil.WriteFile(runPath+"/registry.json", []byte(registry), 0644))
+	previousRunPath := config.LogsAgent.GetString("run_path")
+	config.LogsAgent.Set("run_path", runPath)
+	a := auditor.New(nil)
+	config.LogsAgent.Set("run_path", previousRunPath)
+	a.Start()
+
+	sources := []*config.IntegrationConfigLogSource{&config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: fmt.Sprintf("%s/*.log", globDir)}}
+	s := New(sources, suite.pp, a, NewOpenFilesCounter())
+	defer s.Stop()
+	s.setup()
+
+	// files found after the start resume from their offset, or are tailed from the begining
+	suite.Nil(ioutil.WriteFile(knownPath, []byte("hello world\nhello again\n"), 0644))
+	suite.Nil(ioutil.WriteFile(newPath, []byte("hello new\n"), 0644))
+	s.scan()
+	suite.Equal(2, len(s.tailers))
+	suite.Equal([]string{"hello again", "hello new"}, suite.receiveContents(2))
+}
+
+func (suite *ScannerTestSuite) TestScannerExcludesPaths() {
+	globDir := fmt.Sprintf("%s/exclude", suite.testDir)
+	os.RemoveAll(globDir)
+	os.MkdirAll(fmt.Sprintf("%s/archive", globDir), os.ModePerm)
+	defer os.RemoveAll(globDir)
+
+	appPath := fmt.Sprintf("%s/app.log", globDir)
+	for _, path := range []string{appPath, globDir + "/debug-1.log", globDir + "/archive/app.log"} {
+		f, err := os.Create(path)
+		suite.Nil(err)
+		f.Close()
+	}
+
+	source := &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: fmt.Sprintf("%s/**/*.log", globDir), ExcludePaths: []string{"debug-*.log", globDir + "/archive"}}
+	s := New([]*config.IntegrationConfigLogSource{source}, suite.pp, auditor.New(nil), NewOpenFilesCounter())
+	defer s.Stop()
+	s.setup()
+	suite.Equal(1, len(s.tailers))
+	suite.NotNil(s.tailers[appPath])
+
+	// new files are excluded too
+	f, err := os.Create(fmt.Sprintf("%s/debug-2.log", globDir))
+	suite.Nil(err)
+	f.Close()
+	s.scan()
+	suite.Equal(1, len(s.tailers))
+}
+
+func (suite *ScannerTestSuite) TestScannerAddsAndRemovesSources() {
+	dir := fmt.Sprintf("%s/added", suite.testDir)
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, os.ModePerm)
+	defer os.RemoveAll(dir)
+
+	path := fmt.Sprintf("%s/container-json.log", dir)
+	f, err := os.Create(path)
+	suite.Nil(err)
+	defer f.Close()
+	_, err = f.WriteString(`{"log":"hello world\n","stream":"stderr","time":"2017-10-16T12:00:00Z"}` + "\n")
+	suite.Nil(err)
+
+	s := New(nil, suite.pp, auditor.New(nil), NewOpenFilesCounter())
+	defer s.Stop()
+	s.setup()
+	suite.Equal(0, len(s.tailers))
+
+	// the files of an added source are tailed from the begining
+	source := &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: path, LogFormat: config.LOG_FORMAT_DOCKER}
+	s.AddSource(source)
+	s.scan()
+	suite.NotNil(s.tailers[path])
+	msg := <-suite.outputChan
+	suite.Equal("hello world", string(msg.Content()))
+	suite.Equal(config.SEV_ERROR, msg.GetSeverity())
+	suite.Equal("2017-10-16T12:00:00.000000000Z", msg.GetOrigin().Timestamp)
+	suite.Equal(int64(72), msg.GetOrigin().Offset)
+
+	s.RemoveSource(source)
+	s.scan()
+	suite.Equal(0, len(s.tailers))
+}
+
+func (suite *ScannerTestSuite) TestScannerStopsScanning() {
+	dir := fmt.Sprintf("%s/stopped", suite.testDir)
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, os.ModePerm)
+	defer os.RemoveAll(dir)
+
+	sources := []*config.IntegrationConfigLogSource{&config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: fmt.Sprintf("%s/*.log", dir)}}
+	s := New(sources, suite.pp, auditor.New(nil), NewOpenFilesCounter())
+	s.Start()
+	s.Stop()
+
+	// the files created once the scanner is stopped are not tailed
+	suite.Nil(ioutil.WriteFile(fmt.Sprintf("%s/new.log", dir), []byte("hello\n"), 0644))
+	notify(s.watcher.DirEvents())
+	time.Sleep(100 * time.Millisecond)
+	suite.Equal(0, len(s.tailers))
+}
+
+func (suite *ScannerTestSuite) TestScannerScanWithStartPosition() {
+	globDir := fmt.Sprintf("%s/start", suite.testDir)
+	os.RemoveAll(globDir)
+	os.MkdirAll(globDir, os.ModePerm)
+	defer os.RemoveAll(globDir)
+
+	sources := []*config.IntegrationConfigLogSource{&config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: fmt.Sprintf("%s/*.log", globDir), StartPosition: config.START_POSITION_END}}
+	s := New(sources, suite.pp, auditor.New(nil), NewOpenFilesCounter())
+	defer s.Stop()
+	s.setup()
+
+	// a new file is tailed from its end
+	f, err := os.Create(fmt.Sprintf("%s/new.log", globDir))
+	suite.Nil(err)
+	defer f.Close()
+	_, err = f.WriteString("hello world\n")
+	suite.Nil(err)
+	s.scan()
+	suite.Equal(1, len(s.tailers))
+	suite.waitForReadOffset(s.tailers[f.Name()], 12)
+	_, err = f.WriteString("hello again\n")
+	suite.Nil(err)
+	msg := <-suite.outputChan
+	suite.Equal("hello again", string(msg.Content()))
+}
+
+func (suite *ScannerTestSuite) TestScannerClosesInactiveFiles() {
+	s := suite.s
+	tailer := s.tailers[suite.testPath]
+	_, err := suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	msg := <-suite.outputChan
+	suite.Equal("hello world", string(msg.Content()))
+
+	s.inactiveTimeout = time.Millisecond
+	time.Sleep(10 * time.Millisecond)
+	s.scan()
+	suite.Nil(s.tailers[suite.testPath])
+	suite.NotNil(s.closedFiles[suite.testPath])
+	suite.waitUntilDone(tailer)
+
+	// the file stays closed until it grows
+	s.inactiveTimeout = time.Hour
+	s.scan()
+	suite.Nil(s.tailers[suite.testPath])
+
+	// then it's reopened from where it was closed
+	_, err = suite.testFile.WriteString("hello again\n")
+	suite.Nil(err)
+	s.scan()
+	suite.NotNil(s.tailers[suite.testPath])
+	suite.Equal(0, len(s.closedFiles))
+	msg = <-suite.outputChan
+	suite.Equal("hello again", string(msg.Content()))
+}
+
+func (suite *ScannerTestSuite) TestScannerClosesDeletedFiles() {
+	s := suite.s
+	tailer := s.tailers[suite.testPath]
+	deletedFiles := expvarValue("DeletedFiles")
+	drainedFiles := expvarValue("DeletedFilesDrained")
+	_, err := suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	msg := <-suite.outputChan
+	suite.Equal("hello world", string(msg.Content()))
+
+	// the end of the file is still read once it's deleted
+	_, err = suite.testFile.WriteString("hello again\n")
+	suite.Nil(err)
+	suite.Nil(os.Remove(suite.testPath))
+	s.scan()
+	suite.Nil(s.tailers[suite.testPath])
+	suite.Equal(tailer, s.deletedTailers[suite.testPath])
+	suite.Equal(deletedFiles+1, expvarValue("DeletedFiles"))
+	msg = <-suite.outputChan
+	suite.Equal("hello again", string(msg.Content()))
+
+	// then the file is closed and forgotten
+	suite.waitUntilDone(tailer)
+	s.scan()
+	suite.Equal(0, len(s.deletedTailers))
+	suite.Equal(drainedFiles+1, expvarValue("DeletedFilesDrained"))
+}
+
+func (suite *ScannerTestSuite) TestScannerDoesNotMistakeRotationForDeletion() {
+	s := suite.s
+	suite.Nil(os.Rename(suite.testPath, suite.testRotatedPath))
+	s.scan()
+	suite.Equal(0, len(s.deletedTailers))
+}
+
+func (suite *ScannerTestSuite) TestScannerOpensMostRecentlyModifiedFiles() {
+	globDir := fmt.Sprintf("%s/limit", suite.testDir)
+	os.RemoveAll(globDir)
+	os.MkdirAll(globDir, os.ModePerm)
+	defer os.RemoveAll(globDir)
+
+	// only the files of this scanner are open
+	suite.s.Stop()
+	paths := []string{}
+	files := []*os.File{}
+	for i, name := range []string{"old1", "old2", "new1", "new2"} {
+		path := fmt.Sprintf("%s/%s.log", globDir, name)
+		f, err := os.Create(path)
+		suite.Nil(err)
+		defer f.Close()
+		suite.Nil(os.Chtimes(path, time.Now(), time.Now().Add(time.Duration(i-4)*time.Hour)))
+		paths = append(paths, path)
+		files = append(files, f)
+	}
+
+	sources := []*config.IntegrationConfigLogSource{&config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: fmt.Sprintf("%s/*.log", globDir)}}
+	s := New(sources, suite.pp, auditor.New(nil), NewOpenFilesCounter())
+	defer s.Stop()
+	s.openFilesLimit = 2
+	s.setup()
+	suite.Equal(2, len(s.tailers))
+	newTailers := []*Tailer{s.tailers[paths[2]], s.tailers[paths[3]]}
+	suite.NotNil(newTailers[0])
+	suite.NotNil(newTailers[1])
+
+	// the old files are written, both new files are closed at once to make room for them
+	for i := 0; i < 2; i++ {
+		suite.Nil(os.Chtimes(paths[i+2], time.Now(), time.Now().Add(time.Duration(i-10)*time.Hour)))
+		_, err := files[i].WriteString(fmt.Sprintf("hello %d\n", i))
+		suite.Nil(err)
+	}
+	s.scan()
+	suite.Equal(0, len(s.tailers))
+	suite.waitUntilDone(newTailers[0])
+	suite.waitUntilDone(newTailers[1])
+
+	// the old files are opened once the new files are closed,
+	// and nothing written meanwhile is missed
+	s.scan()
+	suite.Equal(2, len(s.tailers))
+	suite.NotNil(s.tailers[paths[0]])
+	suite.NotNil(s.tailers[paths[1]])
+	suite.ElementsMatch([]string{"hello 0", "hello 1"}, suite.receiveContents(2))
+}
+
+func (suite *ScannerTestSuite) TestScannerOpenFilesLimitIsAgentWide() {
+	globDir := fmt.Sprintf("%s/limit", suite.testDir)
+	os.RemoveAll(globDir)
+	os.MkdirAll(globDir, os.ModePerm)
+	defer os.RemoveAll(globDir)
+
+	suite.s.Stop()
+	openFiles := NewOpenFilesCounter()
+	for _, name := range []string{"first.log", "second.log"} {
+		f, err := os.Create(fmt.Sprintf("%s/%s", globDir, name))
+		suite.Nil(err)
+		f.Close()
+	}
+	first := New([]*config.IntegrationConfigLogSource{&config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: globDir + "/first.log"}}, suite.pp, auditor.New(nil), openFiles)
+	first.openFilesLimit = 1
+	first.setup()
+	suite.Equal(1, len(first.tailers))
+
+	// the file of the first scanner counts in the limit of the second one
+	second := New([]*config.IntegrationConfigLogSource{&config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: globDir + "/second.log"}}, suite.pp, auditor.New(nil), openFiles)
+	defer second.Stop()
+	second.openFilesLimit = 1
+	second.setup()
+	suite.Equal(0, len(second.tailers))
+
+	first.Stop()
+	second.scan()
+	suite.Equal(1, len(second.tailers))
+}
+
+func (suite *ScannerTestSuite) TestScannerReadsCompressedFilesOnce() {
+	globDir := fmt.Sprintf("%s/compressed", suite.testDir)
+	os.RemoveAll(globDir)
+	os.MkdirAll(globDir, os.ModePerm)
+	defer os.RemoveAll(globDir)
+
+	compressedPath := fmt.Sprintf("%s/app.log.1.gz", globDir)
+	f, err := os.Create(compressedPath)
+	suite.Nil(err)
+	w := gzip.NewWriter(f)
+	w.Write([]byte("hello world\n"))
+	w.Close()
+	f.Close()
+
+	// compressed files are ignored by default
+	sources := []*config.IntegrationConfigLogSource{&config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: fmt.Sprintf("%s/app.log*", globDir)}}
+	s := New(sources, suite.pp, auditor.New(nil), NewOpenFilesCounter())
+	s.setup()
+	suite.Equal(0, len(s.tailers))
+	suite.Equal(0, len(s.compressedTailers))
+	s.Stop()
+
+	sources[0].ReadCompressed = true
+	s = New(sources, suite.pp, auditor.New(nil), NewOpenFilesCounter())
+	defer s.Stop()
+	s.setup()
+	suite.Equal(0, len(s.tailers))
+	suite.Equal(1, len(s.compressedTailers))
+	msg := <-suite.outputChan
+	suite.Equal("hello world", string(msg.Content()))
+	suite.True(msg.GetOrigin().Completed)
+	suite.waitUntilDone(s.compressedTailers[compressedPath])
+
+	s.scan()
+	select {
+	case msg = <-suite.outputChan:
+		suite.Fail("unexpected message", string(msg.Content()))
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	os.Remove(compressedPath)
+	s.scan()
+	suite.Equal(0, len(s.compressedTailers))
+}
+
 func TestScannerTestSuite(t *testing.T) {
 	suite.Run(t, new(ScannerTestSuite))
 }
+
+func expvarValue(key string) int64 {
+	v, ok := tailerExpvars.Get(key).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+	return v.Value()
+}
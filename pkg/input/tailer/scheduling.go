@@ -0,0 +1,231 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package tailer
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+)
+
+// OpenFilesCounter counts the files open by each scanner sharing it,
+// as the limit of open files applies to the whole agent
+type OpenFilesCounter struct {
+	mutex  sync.Mutex
+	counts map[*Scanner]int
+}
+
+// NewOpenFilesCounter returns a new OpenFilesCounter
+func NewOpenFilesCounter() *OpenFilesCounter {
+	return &OpenFilesCounter{
+		counts: make(map[*Scanner]int),
+	}
+}
+
+// set sets the number of files open by s
+func (c *OpenFilesCounter) set(s *Scanner, count int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.counts[s] = count
+}
+
+// remove forgets the files of s, which stopped
+func (c *OpenFilesCounter) remove(s *Scanner) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.counts, s)
+}
+
+// countOthers returns the number of files open by the scanners other than s
+func (c *OpenFilesCounter) countOthers(s *Scanner) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	count := 0
+	for scanner, n := range c.counts {
+		if scanner != s {
+			count += n
+		}
+	}
+	return count
+}
+
+// openTailer is the tailer of an open file, with the modification time of the file
+type openTailer struct {
+	path    string
+	tailer  *Tailer
+	modTime time.Time
+}
+
+// closedFile is a file matching a source which is not open,
+// either because it was inactive or because too many files are open
+type closedFile struct {
+	source *config.IntegrationConfigLogSource
+	tailer *Tailer // the tailer that closed the file, nil if it was never open
+	inode  uint64
+
+	// files never open are tailed from the begining, or resume from the auditor,
+	// or from their size when they were found if they were never tailed
+	tailFromBegining bool
+	size             int64
+}
+
+// needsReading returns true if the file was never open,
+// or if it changed since its tailer stopped
+func (f *closedFile) needsReading(stat os.FileInfo) bool {
+	if f.tailer == nil {
+		return true
+	}
+	return stat.Size() != f.tailer.GetReadOffset() || inode(stat) != f.inode
+}
+
+// schedule closes the inactive files, and opens the most recently modified
+// files that need to be read, within the limit of open files of the agent
+func (s *Scanner) schedule() {
+	if s.inactiveTimeout > 0 {
+		for path, tailer := range s.tailers {
+			// tailers which could not open their file are handled by the scan
+			if tailer.file != nil && tailer.inactiveFor() > s.inactiveTimeout {
+				s.closeTailer(path, tailer)
+			}
+		}
+	}
+
+	pending := []string{}
+	modTimes := make(map[string]time.Time)
+	for path, file := range s.closedFiles {
+		if file.tailer != nil && !file.tailer.isDone() {
+			// the file is still being closed
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if file.tailer != nil {
+			// keep the offset of the file as long as it's closed
+			s.auditor.RefreshEntry(file.tailer.Identifier())
+		}
+		if !file.needsReading(stat) {
+			continue
+		}
+		pending = append(pending, path)
+		modTimes[path] = stat.ModTime()
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return modTimes[pending[i]].After(modTimes[pending[j]])
+	})
+
+	othersCount := s.openFiles.countOthers(s)
+	var evictable []openTailer
+	for _, path := range pending {
+		if s.openFilesLimit <= 0 || othersCount+s.openFilesCount() < s.openFilesLimit {
+			s.openFile(path, s.closedFiles[path])
+			continue
+		}
+		// make room for the files modified more recently than open files,
+		// they will be opened once the other files are closed
+		if evictable == nil {
+			evictable = s.tailersByModTime()
+		}
+		if len(evictable) == 0 || !evictable[0].modTime.Before(modTimes[path]) {
+			break
+		}
+		s.closeTailer(evictable[0].path, evictable[0].tailer)
+		evictable = evictable[1:]
+	}
+	s.openFiles.set(s, s.openFilesCount())
+}
+
+// openFilesCount returns the number of files currently open
+func (s *Scanner) openFilesCount() int {
+	count := len(s.tailers) + len(s.rotatedTailers)
+	for _, tailer := range s.compressedTailers {
+		if !tailer.isDone() {
+			count++
+		}
+	}
+	for _, tailer := range s.deletedTailers {
+		if !tailer.isDone() {
+			count++
+		}
+	}
+	for _, file := range s.closedFiles {
+		if file.tailer != nil && !file.tailer.isDone() {
+			count++
+		}
+	}
+	return count
+}
+
+// tailersByModTime returns the tailers of the open files,
+// the least recently modified first
+func (s *Scanner) tailersByModTime() []openTailer {
+	tailers := []openTailer{}
+	for path, tailer := range s.tailers {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		tailers = append(tailers, openTailer{path: path, tailer: tailer, modTime: stat.ModTime()})
+	}
+	sort.Slice(tailers, func(i, j int) bool {
+		return tailers[i].modTime.Before(tailers[j].modTime)
+	})
+	return tailers
+}
+
+// closeTailer lets a tailer read its file until EOF then close it,
+// the file is reopened from where the tailer stopped once it changes
+func (s *Scanner) closeTailer(path string, tailer *Tailer) {
+	// the fingerprint is computed while the file is open,
+	// to detect whether it was rotated while it was closed
+	tailer.Fingerprint()
+	s.closedFiles[path] = &closedFile{
+		source: tailer.source,
+		tailer: tailer,
+		inode:  fileInode(tailer.file),
+	}
+	shouldTrackOffset := true
+	tailer.Stop(shouldTrackOffset)
+	delete(s.tailers, path)
+}
+
+// openFile starts tailing a closed file, from where its previous tailer stopped
+// unless the file was rotated in the meantime
+func (s *Scanner) openFile(path string, file *closedFile) {
+	delete(s.closedFiles, path)
+	if file.tailer == nil {
+		t := NewTailer(s.pp.NextPipelineChan(), file.source, path)
+		offset, whence := t.recoveryOffset(s.auditor)
+		switch {
+		case whence == os.SEEK_CUR:
+			// the file was already tailed, it resumes where it was left
+		case file.tailFromBegining:
+			offset, whence = 0, os.SEEK_SET
+		case whence == os.SEEK_END:
+			// nothing written since the file was found is missed
+			offset, whence = file.size, os.SEEK_SET
+		}
+		s.startTailer(t, offset, whence)
+		return
+	}
+
+	stat, err := os.Stat(path)
+	fingerprint := computeFingerprintForPath(path)
+	if err != nil || inode(stat) != file.inode || stat.Size() < file.tailer.GetReadOffset() ||
+		(fingerprint != "" && file.tailer.Fingerprint() != "" && fingerprint != file.tailer.Fingerprint()) {
+		// the file was rotated while it was closed
+		if rotatedPath := findRotatedFile(path, file.inode, file.tailer.Fingerprint()); rotatedPath != "" {
+			s.drainRotatedFile(file.tailer, file.source, rotatedPath)
+		}
+		s.setupTailer(file.source, path, file.tailer.outputChan)
+		return
+	}
+	s.startTailer(NewTailer(file.tailer.outputChan, file.source, path), file.tailer.getDecodedOffset(), os.SEEK_SET)
+}
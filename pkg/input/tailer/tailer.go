@@ -6,8 +6,11 @@
 package tailer
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -22,16 +25,28 @@ import (
 )
 
 const defaultSleepDuration = 1 * time.Second
+
+// watchedSleepDuration is the polling period of a file whose writes are watched,
+// polling only covers the events a watcher may miss
+const watchedSleepDuration = 10 * time.Second
 const defaultCloseTimeout = 60 * time.Second
 
 // Tailer tails one file and sends messages to an output channel
 type Tailer struct {
-	path string
-	file *os.File
+	path       string
+	file       *os.File
+	reader     io.Reader
+	compressed bool
+	reachedEOF int32
+
+	fingerprint      string
+	fingerprintMutex sync.Mutex
 
 	readOffset        int64
 	decodedOffset     int64
+	startOffset       int64
 	shouldTrackOffset bool
+	lastReadTime      int64
 
 	outputChan chan message.Message
 	d          *decoder.Decoder
@@ -39,17 +54,22 @@ type Tailer struct {
 
 	sleepDuration time.Duration
 	sleepMutex    sync.Mutex
+	watcher       Watcher
+	wakeChan      chan struct{}
 
 	closeTimeout time.Duration
 	shouldStop   bool
 	stopTimer    *time.Timer
 	stopMutex    sync.Mutex
+	done         chan struct{}
 }
 
-// NewTailer returns an initialized Tailer
-func NewTailer(outputChan chan message.Message, source *config.IntegrationConfigLogSource) *Tailer {
+// NewTailer returns an initialized Tailer, tailing the file at path
+// with the rules of source
+func NewTailer(outputChan chan message.Message, source *config.IntegrationConfigLogSource, path string) *Tailer {
 	return &Tailer{
-		path:       source.Path,
+		path:       path,
+		compressed: isCompressed(path),
 		outputChan: outputChan,
 		d:          decoder.InitializeDecoder(source),
 		source:     source,
@@ -62,18 +82,144 @@ func NewTailer(outputChan chan message.Message, source *config.IntegrationConfig
 		shouldStop:    false,
 		stopMutex:     sync.Mutex{},
 		closeTimeout:  defaultCloseTimeout,
+		done:          make(chan struct{}),
 	}
 }
 
-// Identifier returns a string that uniquely identifies a source
+// Identifier returns a string that uniquely identifies a source.
+// Compressed files are identified by their decompressed content,
+// as they are often renamed when logs are rotated again
 func (t *Tailer) Identifier() string {
-	return fmt.Sprintf("file:%s", t.source.Path)
+	if t.compressed {
+		if fingerprint := t.Fingerprint(); fingerprint != "" {
+			return fmt.Sprintf("compressed:%s", fingerprint)
+		}
+	}
+	return fileIdentifier(t.path)
+}
+
+// fileIdentifier returns the identifier of the file at path
+func fileIdentifier(path string) string {
+	return fmt.Sprintf("file:%s", path)
+}
+
+// Fingerprint returns the fingerprint of the file being tailed,
+// or an empty string while the file is too small to be identified.
+// It's computed once, when the tailer has read past fingerprintLength,
+// or before reading a compressed file
+func (t *Tailer) Fingerprint() string {
+	t.fingerprintMutex.Lock()
+	defer t.fingerprintMutex.Unlock()
+	if t.fingerprint == "" && !t.compressed && t.GetReadOffset() >= fingerprintLength {
+		t.fingerprint = computeFingerprint(t.file)
+	}
+	return t.fingerprint
+}
+
+// watch lets the tailer wake up as soon as its file is written
+// instead of waiting for its next poll.
+// It must be called before the tailer starts
+func (t *Tailer) watch(w Watcher) {
+	wakeChan, isWatched := w.WatchFile(t.path)
+	t.watcher = w
+	t.wakeChan = wakeChan
+	if isWatched {
+		t.sleepMutex.Lock()
+		t.sleepDuration = watchedSleepDuration
+		t.sleepMutex.Unlock()
+	}
+}
+
+// recoveryOffset returns the offset following the last log line processed,
+// or the start position of the source if we tail this file for the first time
+func (t *Tailer) recoveryOffset(a *auditor.Auditor) (int64, int) {
+	offset, whence := t.lastCommitedOffset(a, computeFingerprintForPath(t.path))
+	if whence == os.SEEK_END {
+		// the file was never tailed
+		offset, whence = t.startPosition()
+	}
+	return offset, whence
+}
+
+// startPosition returns where to start tailing a file that was never tailed,
+// which is the end of the file unless its source says otherwise
+func (t *Tailer) startPosition() (int64, int) {
+	switch t.source.StartPosition {
+	case config.START_POSITION_BEGINNING:
+		return 0, os.SEEK_SET
+	case config.START_POSITION_LAST_N_BYTES:
+		return lastNBytesOffset(t.path, t.source.LastNBytes, t.source.Encoding, decoder.RawDelimiter(t.source)), os.SEEK_SET
+	default:
+		return 0, os.SEEK_END
+	}
+}
+
+// lastNBytesOffset returns the offset of the first line starting
+// in the last n bytes of the file at path, lines ending with delimiter
+func lastNBytesOffset(path string, n int64, encoding string, delimiter []byte) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil || stat.Size() <= n {
+		return 0
+	}
+	unitLen := int64(1)
+	switch encoding {
+	case config.ENCODING_UTF16LE, config.ENCODING_UTF16BE:
+		unitLen = 2
+	}
+	delimiterLen := int64(len(delimiter))
+	// start on a character boundary
+	offset := stat.Size() - n
+	offset += (unitLen - offset%unitLen) % unitLen
+	// skip the end of the line in progress at offset
+	start := offset - delimiterLen
+	if start < 0 {
+		start = 0
+	}
+	r := bufio.NewReader(io.NewSectionReader(f, start, stat.Size()-start))
+	unit := make([]byte, unitLen)
+	window := []byte{}
+	for position := start; ; position += unitLen {
+		if _, err := io.ReadFull(r, unit); err != nil {
+			return offset
+		}
+		window = append(window, unit...)
+		if int64(len(window)) > delimiterLen {
+			window = window[unitLen:]
+		}
+		if bytes.Equal(window, delimiter) {
+			return position + unitLen
+		}
+	}
 }
 
-// recoverTailing starts the tailing from the last log line processed, or now
-// if we tail this file for the first time
-func (t *Tailer) recoverTailing(a *auditor.Auditor) error {
-	return t.tailFrom(a.GetLastCommitedOffset(t.Identifier()))
+// lastCommitedOffset returns the offset from which we should resume tailing.
+// When the content of the file is known under another identifier,
+// the file was renamed and we resume from its last commited offset.
+// When the content of the file changed since the last commit,
+// the path now points to another file (e.g. its inode was reused)
+// and we tail it from the begining
+func (t *Tailer) lastCommitedOffset(a *auditor.Auditor, fingerprint string) (int64, int) {
+	offset, whence := a.GetLastCommitedOffset(t.Identifier())
+	if fingerprint == "" {
+		return offset, whence
+	}
+	lastFingerprint := a.GetLastCommitedFingerprint(t.Identifier())
+	switch {
+	case whence == os.SEEK_END:
+		// this identifier is unknown to the auditor
+		if identifier := a.GetIdentifierForFingerprint(fingerprint); identifier != "" {
+			log.Println("Resuming tailing of", t.path, "previously tailed as", identifier)
+			return a.GetLastCommitedOffset(identifier)
+		}
+	case lastFingerprint != "" && lastFingerprint != fingerprint:
+		return 0, os.SEEK_SET
+	}
+	return offset, whence
 }
 
 // Stop lets  the tailer stop
@@ -83,6 +229,83 @@ func (t *Tailer) Stop(shouldTrackOffset bool) {
 	t.shouldTrackOffset = shouldTrackOffset
 	t.stopTimer = time.NewTimer(t.closeTimeout)
 	t.stopMutex.Unlock()
+	notify(t.wakeChan)
+}
+
+// stopNow lets the tailer stop without reading its file until EOF.
+// It returns the offset following the last message forwarded,
+// once all the data read was forwarded or after the close timeout
+func (t *Tailer) stopNow() int64 {
+	t.stopMutex.Lock()
+	t.shouldStop = true
+	t.shouldTrackOffset = false
+	t.stopTimer = time.NewTimer(0)
+	t.stopMutex.Unlock()
+	notify(t.wakeChan)
+	select {
+	case <-t.done:
+	case <-time.After(t.closeTimeout):
+		log.Println("Timeout while stopping", t.path)
+	}
+	return t.getDecodedOffset()
+}
+
+// drainFrom lets the tailer read its file from offset until EOF, however long it takes,
+// then stop. This is meant to read what is left in a file after it was rotated
+func (t *Tailer) drainFrom(offset int64) error {
+	t.stopMutex.Lock()
+	t.shouldStop = true
+	t.shouldTrackOffset = true
+	t.stopMutex.Unlock()
+	err := t.tailFrom(offset, os.SEEK_SET)
+	if err != nil {
+		close(t.done)
+	}
+	return err
+}
+
+// readCompressed lets the tailer read its compressed file once,
+// from the last commited offset of its decompressed content until EOF, then stop.
+// A file tailed before it was compressed is read from where it was left
+func (t *Tailer) readCompressed(a *auditor.Auditor) error {
+	t.fingerprintMutex.Lock()
+	t.fingerprint = computeCompressedFingerprint(t.path)
+	t.fingerprintMutex.Unlock()
+	if a.IsCompleted(t.Identifier()) {
+		atomic.StoreInt32(&t.reachedEOF, 1)
+		close(t.done)
+		return nil
+	}
+	offset, whence := t.lastCommitedOffset(a, t.Fingerprint())
+	if whence != os.SEEK_CUR {
+		offset = 0
+	}
+	err := t.drainFrom(offset)
+	if err == nil {
+		log.Println("Reading compressed file", t.path)
+	}
+	return err
+}
+
+// isCompleted returns true when the tailer read its file until EOF and stopped
+func (t *Tailer) isCompleted() bool {
+	return t.isDone() && atomic.LoadInt32(&t.reachedEOF) == 1
+}
+
+// hasForwarded returns true if the tailer forwarded messages,
+// which is not the case of a compressed file read entirely before it was compressed
+func (t *Tailer) hasForwarded() bool {
+	return t.getDecodedOffset() != atomic.LoadInt64(&t.startOffset)
+}
+
+// isDone returns true when the tailer stopped and forwarded all its messages
+func (t *Tailer) isDone() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
 }
 
 // onStop handles the housekeeping when we stop the tailer
@@ -91,7 +314,12 @@ func (t *Tailer) onStop() {
 	t.d.Stop()
 	log.Println("Closing", t.path)
 	t.file.Close()
-	t.stopTimer.Stop()
+	if t.stopTimer != nil {
+		t.stopTimer.Stop()
+	}
+	if t.watcher != nil {
+		t.watcher.UnwatchFile(t.path, t.wakeChan)
+	}
 	t.stopMutex.Unlock()
 }
 
@@ -115,10 +343,26 @@ func (t *Tailer) startReading(offset int64, whence int) error {
 	if err != nil {
 		return err
 	}
-	ret, _ := f.Seek(offset, whence)
+	var ret int64
+	if t.compressed {
+		// compressed files can't seek, their offsets are in decompressed bytes
+		t.reader, err = newDecompressor(t.path, f)
+		if err == nil {
+			ret, err = io.CopyN(ioutil.Discard, t.reader, offset)
+		}
+		if err != nil && err != io.EOF {
+			f.Close()
+			return err
+		}
+	} else {
+		t.reader = f
+		ret, _ = f.Seek(offset, whence)
+	}
 	t.file = f
+	t.lastReadTime = time.Now().UnixNano()
 	t.readOffset = ret
 	t.decodedOffset = ret
+	t.startOffset = ret
 
 	go t.readForever()
 	return nil
@@ -136,27 +380,49 @@ func (t *Tailer) tailFromEnd() error {
 	return t.tailFrom(0, os.SEEK_END)
 }
 
-// forwardMessages lets the Tailer forward log messages to the output channel
+// forwardMessages lets the Tailer forward log messages to the output channel.
+// The last message of a compressed file is held back until we know whether
+// the file was read entirely, to commit its completion
 func (t *Tailer) forwardMessages() {
+	var lastMsg message.Message
 	for output := range t.d.OutputChan {
 		if output.ShouldStop {
+			if lastMsg != nil {
+				lastMsg.GetOrigin().Completed = atomic.LoadInt32(&t.reachedEOF) == 1 && lastMsg.GetOrigin().Identifier != ""
+				t.outputChan <- lastMsg
+			}
+			close(t.done)
 			return
 		}
 
 		fileMsg := message.NewFileMessage(output.Content)
-		msgOffset := t.decodedOffset + int64(output.RawDataLen)
+		msgOffset := t.getDecodedOffset() + int64(output.RawDataLen)
+		atomic.StoreInt64(&t.decodedOffset, msgOffset)
 		identifier := t.Identifier()
+		fingerprint := t.Fingerprint()
 		if !t.shouldTrackOffset {
 			msgOffset = 0
 			identifier = ""
+			fingerprint = ""
 		}
-		t.decodedOffset = msgOffset
 		msgOrigin := message.NewOrigin()
 		msgOrigin.LogSource = t.source
 		msgOrigin.Identifier = identifier
 		msgOrigin.Offset = msgOffset
+		msgOrigin.Fingerprint = fingerprint
+		msgOrigin.Timestamp = output.Timestamp
 		fileMsg.SetOrigin(msgOrigin)
-		t.outputChan <- fileMsg
+		if output.Severity != nil {
+			fileMsg.SetSeverity(output.Severity)
+		}
+		if !t.compressed {
+			t.outputChan <- fileMsg
+			continue
+		}
+		if lastMsg != nil {
+			t.outputChan <- lastMsg
+		}
+		lastMsg = fileMsg
 	}
 }
 
@@ -170,9 +436,16 @@ func (t *Tailer) readForever() {
 		}
 
 		inBuf := make([]byte, 4096)
-		n, err := t.file.Read(inBuf)
+		n, err := t.reader.Read(inBuf)
+		if n > 0 {
+			// decompressors can return data along with EOF
+			t.d.InputChan <- decoder.NewInput(inBuf[:n])
+			t.incrementReadOffset(n)
+			atomic.StoreInt64(&t.lastReadTime, time.Now().UnixNano())
+		}
 		if err == io.EOF {
 			if t.shouldSoftStop() {
+				atomic.StoreInt32(&t.reachedEOF, 1)
 				t.onStop()
 				return
 			}
@@ -181,14 +454,15 @@ func (t *Tailer) readForever() {
 		}
 		if err != nil {
 			log.Println("Err:", err)
+			if t.compressed {
+				// the file may still be being compressed, it will be read again
+				t.onStop()
+			}
 			return
 		}
 		if n == 0 {
 			t.wait()
-			continue
 		}
-		t.d.InputChan <- decoder.NewInput(inBuf[:n])
-		t.incrementReadOffset(n)
 	}
 }
 
@@ -219,9 +493,23 @@ func (t *Tailer) GetReadOffset() int64 {
 	return atomic.LoadInt64(&t.readOffset)
 }
 
-// wait lets the tailer sleep for a bit
+// inactiveFor returns for how long the tailer did not read anything
+func (t *Tailer) inactiveFor() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&t.lastReadTime)))
+}
+
+// getDecodedOffset returns the offset following the last message forwarded
+func (t *Tailer) getDecodedOffset() int64 {
+	return atomic.LoadInt64(&t.decodedOffset)
+}
+
+// wait lets the tailer sleep for a bit, or until its file is written
 func (t *Tailer) wait() {
 	t.sleepMutex.Lock()
-	defer t.sleepMutex.Unlock()
-	time.Sleep(t.sleepDuration)
+	sleepDuration := t.sleepDuration
+	t.sleepMutex.Unlock()
+	select {
+	case <-t.wakeChan:
+	case <-time.After(sleepDuration):
+	}
 }
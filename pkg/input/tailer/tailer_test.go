@@ -6,12 +6,17 @@
 package tailer
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"os"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/DataDog/datadog-log-agent/pkg/auditor"
 	"github.com/DataDog/datadog-log-agent/pkg/config"
 	"github.com/DataDog/datadog-log-agent/pkg/decoder"
 	"github.com/DataDog/datadog-log-agent/pkg/message"
@@ -25,6 +30,7 @@ type TailerTestSuite struct {
 	testDir  string
 	testPath string
 	testFile *os.File
+	runPath  string
 
 	tl         *Tailer
 	outputChan chan message.Message
@@ -39,12 +45,14 @@ func (suite *TailerTestSuite) SetupTest() {
 	f, err := os.Create(suite.testPath)
 	suite.Nil(err)
 	suite.testFile = f
+	suite.runPath, err = ioutil.TempDir("", "tailer")
+	suite.Nil(err)
 	suite.outputChan = make(chan message.Message, chanSize)
 	suite.source = &config.IntegrationConfigLogSource{
 		Type: config.FILE_TYPE,
 		Path: suite.testPath,
 	}
-	suite.tl = NewTailer(suite.outputChan, suite.source)
+	suite.tl = NewTailer(suite.outputChan, suite.source, suite.testPath)
 	suite.tl.sleepDuration = 10 * time.Millisecond
 }
 
@@ -52,6 +60,7 @@ func (suite *TailerTestSuite) TearDownTest() {
 	suite.tl.Stop(false)
 	suite.testFile.Close()
 	os.Remove(suite.testDir)
+	os.RemoveAll(suite.runPath)
 }
 
 func (suite *TailerTestSuite) TestTailerTails() {
@@ -70,6 +79,24 @@ func (suite *TailerTestSuite) TestTailerTails() {
 	suite.Equal("file:tests/tailer/tailer.log", suite.tl.Identifier())
 }
 
+func (suite *TailerTestSuite) TestTailerParsesCRILogs() {
+	suite.source.LogFormat = config.LOG_FORMAT_CRI
+	tl := NewTailer(suite.outputChan, suite.source, suite.testPath)
+	defer tl.Stop(false)
+	tl.tailFromBegining()
+
+	_, err := suite.testFile.WriteString("2017-10-16T12:00:00.5Z stdout F hello world\n2017-10-16T12:00:01Z stderr F boom\n")
+	suite.Nil(err)
+	msg := <-suite.outputChan
+	suite.Equal("hello world", string(msg.Content()))
+	suite.Equal("2017-10-16T12:00:00.500000000Z", msg.GetOrigin().Timestamp)
+	suite.Nil(msg.GetSeverity())
+	suite.Equal(int64(44), msg.GetOrigin().Offset)
+	msg = <-suite.outputChan
+	suite.Equal("boom", string(msg.Content()))
+	suite.Equal(config.SEV_ERROR, msg.GetSeverity())
+}
+
 func (suite *TailerTestSuite) TestTailerIdentifier() {
 	suite.Equal("file:tests/tailer/tailer.log", suite.tl.Identifier())
 }
@@ -81,6 +108,22 @@ func (suite *TailerTestSuite) TestTailerLifecycle() {
 	// this will be fixed when we implement stop pills
 }
 
+func (suite *TailerTestSuite) TestTailerWakesUpWhenNotified() {
+	suite.tl.sleepDuration = time.Hour
+	suite.tl.wakeChan = make(chan struct{}, 1)
+	suite.tl.tailFromEnd()
+
+	_, err := suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	notify(suite.tl.wakeChan)
+	select {
+	case msg := <-suite.outputChan:
+		suite.Equal("hello world", string(msg.Content()))
+	case <-time.After(5 * time.Second):
+		suite.Fail("the tailer was not woken up")
+	}
+}
+
 func writeMessage(file *os.File) {
 	time.Sleep(time.Millisecond)
 	file.WriteString("hello world\n")
@@ -148,7 +191,7 @@ func (suite *TailerTestSuite) TestTailerIsTooSlowAndClosed() {
 	testPath := fmt.Sprintf("%s/tailer2.log", suite.testDir)
 	testFile, _ := os.Create(testPath)
 	defer testFile.Close()
-	tl := NewTailer(nil, &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: testPath})
+	tl := NewTailer(nil, &config.IntegrationConfigLogSource{Type: config.FILE_TYPE, Path: testPath}, testPath)
 	tl.sleepDuration = 50 * time.Millisecond
 	tl.closeTimeout = 2 * time.Millisecond
 
@@ -178,6 +221,234 @@ func (suite *TailerTestSuite) TestTailerIsTooSlowAndClosed() {
 	suite.Equal(int(atomic.LoadUint64(&messagesReceived)), int(received))
 }
 
+func (suite *TailerTestSuite) TestTailerFingerprint() {
+	suite.tl.tailFromEnd()
+	suite.Equal("", suite.tl.Fingerprint())
+
+	_, err := suite.testFile.WriteString(strings.Repeat("a", fingerprintLength) + "\n")
+	suite.Nil(err)
+	<-suite.outputChan
+	fingerprint := suite.tl.Fingerprint()
+	suite.NotEqual("", fingerprint)
+	suite.Equal(fingerprint, computeFingerprintForPath(suite.testPath))
+
+	// only the begining of the file matters
+	_, err = suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	suite.Equal(fingerprint, computeFingerprintForPath(suite.testPath))
+}
+
+// newTestAuditor returns a started auditor recovering the registry
+func (suite *TailerTestSuite) newTestAuditor(registry string) *auditor.Auditor {
+	runPath := config.LogsAgent.GetString("run_path")
+	config.LogsAgent.Set("run_path", suite.runPath)
+	defer config.LogsAgent.Set("run_path", runPath)
+	err := ioutil.WriteFile(fmt.Sprintf("%s/registry.json", suite.runPath), []byte(registry), 0644)
+	suite.Nil(err)
+	a := auditor.New(nil)
+	a.Start()
+	return a
+}
+
+func (suite *TailerTestSuite) TestTailerRecoversOffsetWithFingerprint() {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var offset int64
+	var whence int
+
+	// the file was renamed
+	a := suite.newTestAuditor(`{"Version":1,"Registry":{"file:tests/tailer/renamed.log":{"Offset":42,"LastUpdated":"` + now + `","Fingerprint":"abc"}}}`)
+	offset, whence = suite.tl.lastCommitedOffset(a, "abc")
+	suite.Equal(int64(42), offset)
+	suite.Equal(os.SEEK_CUR, whence)
+
+	// the file is unknown
+	offset, whence = suite.tl.lastCommitedOffset(a, "def")
+	suite.Equal(int64(0), offset)
+	suite.Equal(os.SEEK_END, whence)
+
+	// the file is known
+	a = suite.newTestAuditor(`{"Version":1,"Registry":{"file:tests/tailer/tailer.log":{"Offset":42,"LastUpdated":"` + now + `","Fingerprint":"abc"}}}`)
+	offset, whence = suite.tl.lastCommitedOffset(a, "abc")
+	suite.Equal(int64(42), offset)
+	suite.Equal(os.SEEK_CUR, whence)
+
+	// the file is too small to be identified
+	offset, whence = suite.tl.lastCommitedOffset(a, "")
+	suite.Equal(int64(42), offset)
+	suite.Equal(os.SEEK_CUR, whence)
+
+	// another file was created at the same path
+	offset, whence = suite.tl.lastCommitedOffset(a, "def")
+	suite.Equal(int64(0), offset)
+	suite.Equal(os.SEEK_SET, whence)
+}
+
+func (suite *TailerTestSuite) TestTailerStartPosition() {
+	_, err := suite.testFile.WriteString("hello world\nhello again\n")
+	suite.Nil(err)
+
+	var offset int64
+	var whence int
+	offset, whence = suite.tl.startPosition()
+	suite.Equal(int64(0), offset)
+	suite.Equal(os.SEEK_END, whence)
+
+	suite.source.StartPosition = config.START_POSITION_BEGINNING
+	offset, whence = suite.tl.startPosition()
+	suite.Equal(int64(0), offset)
+	suite.Equal(os.SEEK_SET, whence)
+
+	suite.source.StartPosition = config.START_POSITION_LAST_N_BYTES
+	suite.source.LastNBytes = 15
+	offset, whence = suite.tl.startPosition()
+	suite.Equal(int64(12), offset)
+	suite.Equal(os.SEEK_SET, whence)
+
+	suite.Equal(int64(12), lastNBytesOffset(suite.testPath, 12, "", []byte("\n")))
+	suite.Equal(int64(0), lastNBytesOffset(suite.testPath, 100, "", []byte("\n")))
+	suite.Equal(int64(24), lastNBytesOffset(suite.testPath, 5, "", []byte("\n")))
+}
+
+func (suite *TailerTestSuite) TestTailerLastNBytesOffsetWithUTF16() {
+	// "ab\ncd\n" encoded in UTF-16LE
+	_, err := suite.testFile.Write([]byte{'a', 0, 'b', 0, '\n', 0, 'c', 0, 'd', 0, '\n', 0})
+	suite.Nil(err)
+	suite.Equal(int64(6), lastNBytesOffset(suite.testPath, 6, config.ENCODING_UTF16LE, []byte{'\n', 0}))
+	suite.Equal(int64(6), lastNBytesOffset(suite.testPath, 9, config.ENCODING_UTF16LE, []byte{'\n', 0}))
+	suite.Equal(int64(12), lastNBytesOffset(suite.testPath, 5, config.ENCODING_UTF16LE, []byte{'\n', 0}))
+}
+
+func (suite *TailerTestSuite) TestTailerLastNBytesOffsetWithDelimiter() {
+	_, err := suite.testFile.WriteString("hello\nworld||hello\nagain||")
+	suite.Nil(err)
+	suite.Equal(int64(13), lastNBytesOffset(suite.testPath, 13, "", []byte("||")))
+	suite.Equal(int64(13), lastNBytesOffset(suite.testPath, 14, "", []byte("||")))
+	suite.Equal(int64(26), lastNBytesOffset(suite.testPath, 10, "", []byte("||")))
+}
+
+func (suite *TailerTestSuite) TestTailerRecoversFromStartPosition() {
+	_, err := suite.testFile.WriteString("hello world\nhello again\n")
+	suite.Nil(err)
+
+	suite.source.StartPosition = config.START_POSITION_BEGINNING
+	suite.Nil(suite.tl.tailFrom(suite.tl.recoveryOffset(suite.newTestAuditor(`{"Version":1,"Registry":{}}`))))
+	msg := <-suite.outputChan
+	suite.Equal("hello world", string(msg.Content()))
+	msg = <-suite.outputChan
+	suite.Equal("hello again", string(msg.Content()))
+}
+
+// writeCompressedFile writes lines to a gzip file at path
+func (suite *TailerTestSuite) writeCompressedFile(path string, lines []string) {
+	f, err := os.Create(path)
+	suite.Nil(err)
+	defer f.Close()
+	w := gzip.NewWriter(f)
+	for _, line := range lines {
+		_, err = w.Write([]byte(line + "\n"))
+		suite.Nil(err)
+	}
+	suite.Nil(w.Close())
+}
+
+// randomLines returns n random lines, large enough to be identified by their fingerprint
+func randomLines(n int) []string {
+	r := rand.New(rand.NewSource(0))
+	lines := []string{}
+	for i := 0; i < n; i++ {
+		lines = append(lines, fmt.Sprintf("%03d %016x%016x", i, r.Int63(), r.Int63()))
+	}
+	return lines
+}
+
+func (suite *TailerTestSuite) TestTailerReadsCompressedFile() {
+	path := suite.testDir + "/tailer.log.1.gz"
+	lines := randomLines(100)
+	suite.writeCompressedFile(path, lines)
+
+	tl := NewTailer(suite.outputChan, suite.source, path)
+	suite.Nil(tl.readCompressed(suite.newTestAuditor(`{"Version":1,"Registry":{}}`)))
+	suite.Equal("compressed:"+computeCompressedFingerprint(path), tl.Identifier())
+	var msg message.Message
+	for i := 0; i < len(lines); i++ {
+		msg = <-suite.outputChan
+		suite.Equal(lines[i], string(msg.Content()))
+		suite.Equal(tl.Identifier(), msg.GetOrigin().Identifier)
+		suite.Equal(int64((i+1)*(len(lines[i])+1)), msg.GetOrigin().Offset)
+		suite.Equal(i == len(lines)-1, msg.GetOrigin().Completed)
+	}
+	<-tl.done
+	suite.True(tl.isCompleted())
+
+	// the file is read from the last commited offset
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	tl = NewTailer(suite.outputChan, suite.source, path)
+	a := suite.newTestAuditor(fmt.Sprintf(`{"Version":1,"Registry":{"%s":{"Offset":%d,"LastUpdated":"%s"}}}`, msg.GetOrigin().Identifier, 98*(len(lines[0])+1), now))
+	suite.Nil(tl.readCompressed(a))
+	msg = <-suite.outputChan
+	suite.Equal(lines[98], string(msg.Content()))
+	msg = <-suite.outputChan
+	suite.Equal(lines[99], string(msg.Content()))
+	suite.True(msg.GetOrigin().Completed)
+	<-tl.done
+
+	// a completed file is never read again
+	tl = NewTailer(suite.outputChan, suite.source, path)
+	a = suite.newTestAuditor(fmt.Sprintf(`{"Version":1,"Registry":{"%s":{"Offset":%d,"LastUpdated":"%s","Completed":true}}}`, msg.GetOrigin().Identifier, msg.GetOrigin().Offset, now))
+	suite.Nil(tl.readCompressed(a))
+	suite.True(tl.isCompleted())
+	select {
+	case msg = <-suite.outputChan:
+		suite.Fail("unexpected message", string(msg.Content()))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
 func TestTailerTestSuite(t *testing.T) {
 	suite.Run(t, new(TailerTestSuite))
 }
+
+func (suite *TailerTestSuite) TestTailerDoesNotReadTailedFileAgainOnceCompressed() {
+	lines := randomLines(100)
+	for _, line := range lines[:98] {
+		_, err := suite.testFile.WriteString(line + "\n")
+		suite.Nil(err)
+	}
+	suite.Nil(suite.tl.tailFromBegining())
+	var msg message.Message
+	for i := 0; i < 98; i++ {
+		msg = <-suite.outputChan
+	}
+	suite.Equal(lines[97], string(msg.Content()))
+	suite.tl.Stop(false)
+
+	// the file is rotated then compressed with lines written after it was last read
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	registry := fmt.Sprintf(`{"Version":1,"Registry":{"%s":{"Offset":%d,"LastUpdated":"%s","Fingerprint":"%s"}}}`, msg.GetOrigin().Identifier, msg.GetOrigin().Offset, now, msg.GetOrigin().Fingerprint)
+	path := suite.testDir + "/tailer.log.2.gz"
+	suite.writeCompressedFile(path, lines)
+	defer os.Remove(path)
+	tl := NewTailer(suite.outputChan, suite.source, path)
+	suite.Nil(tl.readCompressed(suite.newTestAuditor(registry)))
+	suite.Equal("compressed:"+msg.GetOrigin().Fingerprint, tl.Identifier())
+	msg = <-suite.outputChan
+	suite.Equal(lines[98], string(msg.Content()))
+	msg = <-suite.outputChan
+	suite.Equal(lines[99], string(msg.Content()))
+	suite.True(msg.GetOrigin().Completed)
+	<-tl.done
+	suite.True(tl.hasForwarded())
+
+	// the file was read entirely before it was compressed
+	registry = fmt.Sprintf(`{"Version":1,"Registry":{"file:tests/tailer/tailer.log.1":{"Offset":%d,"LastUpdated":"%s","Fingerprint":"%s"}}}`, msg.GetOrigin().Offset, now, msg.GetOrigin().Fingerprint)
+	tl = NewTailer(suite.outputChan, suite.source, path)
+	suite.Nil(tl.readCompressed(suite.newTestAuditor(registry)))
+	<-tl.done
+	suite.True(tl.isCompleted())
+	suite.False(tl.hasForwarded())
+	select {
+	case msg = <-suite.outputChan:
+		suite.Fail("unexpected message", string(msg.Content()))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,58 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package tailer
+
+// A Watcher notifies tailers when their file is written, and the scanner
+// when files are created, renamed or removed, so that they don't have to
+// wait for their next poll.
+// Polling remains the fallback when changes can't be watched,
+// for instance on network filesystems
+type Watcher interface {
+	// WatchFile returns a channel notified when the file at path is written,
+	// and whether changes of the file can actually be watched
+	WatchFile(path string) (chan struct{}, bool)
+	// UnwatchFile stops notifying wakeChan
+	UnwatchFile(path string, wakeChan chan struct{})
+	// WatchDir lets the watcher notify DirEvents when files
+	// are created, renamed or removed in dir, or in its subdirectories when recursive
+	WatchDir(dir string, recursive bool)
+	// DirEvents returns a channel notified when watched directories change
+	DirEvents() chan struct{}
+	// Stop stops the watcher
+	Stop()
+}
+
+// pollingWatcher never notifies anything,
+// tailers and scanner rely on polling only
+type pollingWatcher struct{}
+
+// newPollingWatcher returns a new pollingWatcher
+func newPollingWatcher() *pollingWatcher {
+	return &pollingWatcher{}
+}
+
+func (w *pollingWatcher) WatchFile(path string) (chan struct{}, bool) {
+	return make(chan struct{}, 1), false
+}
+
+func (w *pollingWatcher) UnwatchFile(path string, wakeChan chan struct{}) {}
+
+func (w *pollingWatcher) WatchDir(dir string, recursive bool) {}
+
+func (w *pollingWatcher) DirEvents() chan struct{} {
+	return nil
+}
+
+func (w *pollingWatcher) Stop() {}
+
+// notify sends a notification on c without blocking,
+// pending notifications are merged
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,258 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package tailer
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// networkFilesystems lists the magic numbers of filesystems
+// on which inotify doesn't report changes made by other hosts
+var networkFilesystems = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517b:     true, // SMB
+	0xfe534d42: true, // SMB2
+	0xff534d42: true, // CIFS
+}
+
+// inotifyWatcher watches the directories of the files to tail with inotify
+type inotifyWatcher struct {
+	fd   int
+	file *os.File
+
+	mu        sync.Mutex
+	watches   map[int32]string
+	dirs      map[string]bool
+	recursive map[string]bool
+	wakeChans map[string][]chan struct{}
+	dirEvents chan struct{}
+}
+
+// NewWatcher returns an inotify based Watcher,
+// or a Watcher relying on polling if inotify is not available
+func NewWatcher() Watcher {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		log.Println("Can't watch files, falling back to polling:", err)
+		return newPollingWatcher()
+	}
+	w := &inotifyWatcher{
+		fd:        fd,
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		watches:   make(map[int32]string),
+		dirs:      make(map[string]bool),
+		recursive: make(map[string]bool),
+		wakeChans: make(map[string][]chan struct{}),
+		dirEvents: make(chan struct{}, 1),
+	}
+	go w.run()
+	return w
+}
+
+// WatchFile returns a channel notified when the file at path is written
+func (w *inotifyWatcher) WatchFile(path string) (chan struct{}, bool) {
+	path = filepath.Clean(path)
+	wakeChan := make(chan struct{}, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.wakeChans[path] = append(w.wakeChans[path], wakeChan)
+	return wakeChan, w.watchDir(filepath.Dir(path))
+}
+
+// UnwatchFile stops notifying wakeChan
+func (w *inotifyWatcher) UnwatchFile(path string, wakeChan chan struct{}) {
+	path = filepath.Clean(path)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wakeChans := []chan struct{}{}
+	for _, c := range w.wakeChans[path] {
+		if c != wakeChan {
+			wakeChans = append(wakeChans, c)
+		}
+	}
+	if len(wakeChans) == 0 {
+		delete(w.wakeChans, path)
+	} else {
+		w.wakeChans[path] = wakeChans
+	}
+}
+
+// WatchDir lets the watcher notify DirEvents when dir changes,
+// or when one of its subdirectories changes when recursive
+func (w *inotifyWatcher) WatchDir(dir string, recursive bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if recursive {
+		w.watchTree(filepath.Clean(dir))
+	} else {
+		w.watchDir(filepath.Clean(dir))
+	}
+}
+
+// DirEvents returns a channel notified when watched directories change
+func (w *inotifyWatcher) DirEvents() chan struct{} {
+	return w.dirEvents
+}
+
+// Stop stops the watcher
+func (w *inotifyWatcher) Stop() {
+	w.file.Close()
+}
+
+// watchDir adds an inotify watch on dir if possible,
+// and returns whether dir is watched.
+// The caller must hold the lock
+func (w *inotifyWatcher) watchDir(dir string) bool {
+	if isWatched, ok := w.dirs[dir]; ok {
+		return isWatched
+	}
+	if isNetworkFilesystem(dir) {
+		log.Println("Can't watch", dir, "on a network filesystem, falling back to polling")
+		w.dirs[dir] = false
+		return false
+	}
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err == syscall.ENOENT {
+		// the directory may not exist yet, we'll try again later
+		return false
+	}
+	if err != nil {
+		// for instance when fs.inotify.max_user_watches is reached
+		log.Println("Can't watch", dir, err, "falling back to polling")
+		w.dirs[dir] = false
+		return false
+	}
+	w.watches[int32(wd)] = dir
+	w.dirs[dir] = true
+	return true
+}
+
+// watchTree adds inotify watches on dir and its subdirectories,
+// the subdirectories created later are watched as they appear.
+// The caller must hold the lock
+func (w *inotifyWatcher) watchTree(dir string) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if !w.watchDir(path) {
+			return filepath.SkipDir
+		}
+		w.recursive[path] = true
+		return nil
+	})
+}
+
+// unwatchTree removes the inotify watches of dir and its subdirectories,
+// which were removed or moved away.
+// The caller must hold the lock
+func (w *inotifyWatcher) unwatchTree(dir string) {
+	for wd, path := range w.watches {
+		if isInTree(path, dir) {
+			syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watches, wd)
+		}
+	}
+	for path := range w.dirs {
+		if isInTree(path, dir) {
+			delete(w.dirs, path)
+			delete(w.recursive, path)
+		}
+	}
+}
+
+// isInTree returns true if path is dir or one of its subdirectories
+func isInTree(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// run reads inotify events until the watcher is stopped
+func (w *inotifyWatcher) run() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		offset := 0
+		for offset+syscall.SizeofInotifyEvent <= n {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			if nameEnd > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00")
+			w.handleEvent(event.Wd, event.Mask, name)
+			offset = nameEnd
+		}
+	}
+}
+
+// handleEvent notifies the tailers of a file that was written,
+// and the scanner when files are created, renamed or removed
+func (w *inotifyWatcher) handleEvent(wd int32, mask uint32, name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// some events were lost, wake everyone up
+		for _, wakeChans := range w.wakeChans {
+			for _, c := range wakeChans {
+				notify(c)
+			}
+		}
+		notify(w.dirEvents)
+		return
+	}
+
+	dir, ok := w.watches[wd]
+	if !ok {
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		// the directory was removed
+		delete(w.watches, wd)
+		delete(w.dirs, dir)
+		delete(w.recursive, dir)
+		notify(w.dirEvents)
+		return
+	}
+	if mask&syscall.IN_ISDIR != 0 {
+		path := filepath.Join(dir, name)
+		switch {
+		case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && w.recursive[dir]:
+			w.watchTree(path)
+		case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+			w.unwatchTree(path)
+		}
+	}
+	if mask&syscall.IN_MODIFY != 0 {
+		for _, c := range w.wakeChans[filepath.Join(dir, name)] {
+			notify(c)
+		}
+	}
+	if mask&(syscall.IN_CREATE|syscall.IN_DELETE|syscall.IN_MOVED_FROM|syscall.IN_MOVED_TO) != 0 {
+		notify(w.dirEvents)
+	}
+}
+
+// isNetworkFilesystem returns true if dir is on a network filesystem
+func isNetworkFilesystem(dir string) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return false
+	}
+	return networkFilesystems[uint32(stat.Type)]
+}
@@ -0,0 +1,134 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package tailer
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WatcherTestSuite struct {
+	suite.Suite
+	testDir  string
+	testPath string
+	testFile *os.File
+
+	w Watcher
+}
+
+func (suite *WatcherTestSuite) SetupTest() {
+	suite.testDir = "tests/watcher"
+	os.RemoveAll(suite.testDir)
+	os.MkdirAll(suite.testDir, os.ModePerm)
+	suite.testPath = suite.testDir + "/watcher.log"
+	f, err := os.Create(suite.testPath)
+	suite.Nil(err)
+	suite.testFile = f
+	suite.w = NewWatcher()
+}
+
+func (suite *WatcherTestSuite) TearDownTest() {
+	suite.w.Stop()
+	suite.testFile.Close()
+	os.RemoveAll(suite.testDir)
+}
+
+func (suite *WatcherTestSuite) isNotified(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func (suite *WatcherTestSuite) TestWatcherWakesUpOnWrite() {
+	wakeChan, isWatched := suite.w.WatchFile(suite.testPath)
+	suite.True(isWatched)
+	otherWakeChan, _ := suite.w.WatchFile(suite.testDir + "/other.log")
+
+	_, err := suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	suite.True(suite.isNotified(wakeChan))
+	suite.False(suite.isNotified(otherWakeChan))
+
+	suite.w.UnwatchFile(suite.testPath, wakeChan)
+	_, err = suite.testFile.WriteString("hello again\n")
+	suite.Nil(err)
+	suite.False(suite.isNotified(wakeChan))
+}
+
+func (suite *WatcherTestSuite) TestWatcherNotifiesDirEvents() {
+	suite.w.WatchDir(suite.testDir, false)
+
+	f, err := os.Create(suite.testDir + "/new.log")
+	suite.Nil(err)
+	f.Close()
+	suite.True(suite.isNotified(suite.w.DirEvents()))
+
+	suite.Nil(os.Rename(suite.testDir+"/new.log", suite.testDir+"/new.log.1"))
+	suite.True(suite.isNotified(suite.w.DirEvents()))
+
+	suite.Nil(os.Remove(suite.testDir + "/new.log.1"))
+	suite.True(suite.isNotified(suite.w.DirEvents()))
+
+	// writes don't change the directory
+	suite.isNotified(suite.w.DirEvents())
+	_, err = suite.testFile.WriteString("hello world\n")
+	suite.Nil(err)
+	suite.False(suite.isNotified(suite.w.DirEvents()))
+}
+
+func (suite *WatcherTestSuite) TestWatcherWatchesMissingDirLater() {
+	missingDir := suite.testDir + "/missing"
+	_, isWatched := suite.w.WatchFile(missingDir + "/app.log")
+	suite.False(isWatched)
+
+	suite.Nil(os.MkdirAll(missingDir, os.ModePerm))
+	_, isWatched = suite.w.WatchFile(missingDir + "/app.log")
+	suite.True(isWatched)
+}
+
+func (suite *WatcherTestSuite) TestWatcherWatchesSubdirectoriesRecursively() {
+	suite.Nil(os.MkdirAll(suite.testDir+"/a/b", os.ModePerm))
+	suite.w.WatchDir(suite.testDir, true)
+	w := suite.w.(*inotifyWatcher)
+
+	// existing subdirectories are watched
+	f, err := os.Create(suite.testDir + "/a/b/app.log")
+	suite.Nil(err)
+	f.Close()
+	suite.True(suite.isNotified(w.DirEvents()))
+
+	// so are new subdirectories, and the files created in them
+	suite.Nil(os.Mkdir(suite.testDir+"/c", os.ModePerm))
+	suite.True(suite.isNotified(w.DirEvents()))
+	f, err = os.Create(suite.testDir + "/c/app.log")
+	suite.Nil(err)
+	f.Close()
+	suite.True(suite.isNotified(w.DirEvents()))
+
+	// directories moved away or removed are not watched anymore
+	suite.Nil(os.Rename(suite.testDir+"/a", suite.testDir+"/d"))
+	suite.True(suite.isNotified(w.DirEvents()))
+	suite.Nil(os.RemoveAll(suite.testDir + "/c"))
+	suite.True(suite.isNotified(w.DirEvents()))
+	time.Sleep(100 * time.Millisecond)
+	w.mu.Lock()
+	watched := []string{}
+	for _, dir := range w.watches {
+		watched = append(watched, dir)
+	}
+	w.mu.Unlock()
+	suite.ElementsMatch([]string{suite.testDir, suite.testDir + "/d", suite.testDir + "/d/b"}, watched)
+}
+
+func TestWatcherTestSuite(t *testing.T) {
+	suite.Run(t, new(WatcherTestSuite))
+}
@@ -0,0 +1,15 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+//go:build !linux
+// +build !linux
+
+package tailer
+
+// NewWatcher returns a Watcher relying on polling,
+// as file events are only watched on linux
+func NewWatcher() Watcher {
+	return newPollingWatcher()
+}
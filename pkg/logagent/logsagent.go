@@ -35,9 +35,12 @@ func Start() {
 	l := listener.New(config.GetLogsSources(), pp)
 	l.Start()
 
-	s := tailer.New(config.GetLogsSources(), pp, a)
+	// the limit of open files applies to the files of all the scanners
+	openFiles := tailer.NewOpenFilesCounter()
+
+	s := tailer.New(config.GetLogsSources(), pp, a, openFiles)
 	s.Start()
 
-	c := container.New(config.GetLogsSources(), pp, a)
+	c := container.New(config.GetLogsSources(), pp, a, openFiles)
 	c.Start()
 }
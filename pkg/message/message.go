@@ -15,19 +15,26 @@ type Message interface {
 	SetContent([]byte)
 	GetOrigin() *MessageOrigin
 	SetOrigin(*MessageOrigin)
-	GetTimestamp() string // No need for SetTimestamp as we use MessageOrigin under the hood
+	GetTimestamp() string
+	SetTimestamp(string)
 	GetSeverity() []byte
 	SetSeverity([]byte)
 	GetTagsPayload() []byte
 	SetTagsPayload([]byte)
+	GetService() string
+	SetService(string)
+	GetHostname() string
+	SetHostname(string)
 }
 
 // MessageOrigin represents the Origin of a message
 type MessageOrigin struct {
-	Identifier string
-	LogSource  *config.IntegrationConfigLogSource
-	Offset     int64
-	Timestamp  string
+	Identifier  string
+	LogSource   *config.IntegrationConfigLogSource
+	Offset      int64
+	Timestamp   string
+	Fingerprint string
+	Completed   bool // the source was read entirely and won't be read again
 }
 
 type message struct {
@@ -35,6 +42,9 @@ type message struct {
 	Origin      *MessageOrigin
 	severity    []byte
 	tagsPayload []byte
+	timestamp   string
+	service     string
+	hostname    string
 }
 
 // Content returns the content the message, the actual log line
@@ -58,13 +68,24 @@ func (m *message) SetOrigin(Origin *MessageOrigin) {
 }
 
 // GetTimestamp returns the timestamp of the message, or "" if no timestamp is relevant
+// It will default on the timestamp of the Origin, but can
+// be overriden in the message itself with timestamp
 func (m *message) GetTimestamp() string {
+	if m.timestamp != "" {
+		return m.timestamp
+	}
 	if m.Origin != nil {
 		return m.Origin.Timestamp
 	}
 	return ""
 }
 
+// SetTimestamp sets the timestamp of the message, without changing
+// the timestamp of the Origin used to resume reading the source
+func (m *message) SetTimestamp(timestamp string) {
+	m.timestamp = timestamp
+}
+
 // GetSeverity returns the severity of the message when set
 func (m *message) GetSeverity() []byte {
 	return m.severity
@@ -93,6 +114,34 @@ func (m *message) SetTagsPayload(tagsPayload []byte) {
 	m.tagsPayload = tagsPayload
 }
 
+// GetService returns the service of the message
+// It will default on the LogSource service, but can
+// be overriden in the message itself with service
+func (m *message) GetService() string {
+	if m.service != "" {
+		return m.service
+	}
+	if m.Origin != nil && m.Origin.LogSource != nil {
+		return m.Origin.LogSource.Service
+	}
+	return ""
+}
+
+// SetService sets the service of the message
+func (m *message) SetService(service string) {
+	m.service = service
+}
+
+// GetHostname returns the hostname of the message, or "" if the host of the agent is relevant
+func (m *message) GetHostname() string {
+	return m.hostname
+}
+
+// SetHostname sets the hostname of the message, for messages sent from another host
+func (m *message) SetHostname(hostname string) {
+	m.hostname = hostname
+}
+
 // NewMessage returns a new message
 func NewMessage(content []byte) *message {
 	return &message{
@@ -32,4 +32,17 @@ func TestMessage(t *testing.T) {
 	message.SetTagsPayload([]byte("messageTags"))
 	assert.Equal(t, "messageTags", string(message.GetTagsPayload()))
 
+	message.SetTimestamp("messageTs")
+	assert.Equal(t, "messageTs", message.GetTimestamp())
+	assert.Equal(t, "ts", o.Timestamp)
+
+	o.LogSource.Service = "sourceService"
+	assert.Equal(t, "sourceService", message.GetService())
+	message.SetService("messageService")
+	assert.Equal(t, "messageService", message.GetService())
+
+	assert.Equal(t, "", message.GetHostname())
+	message.SetHostname("messageHost")
+	assert.Equal(t, "messageHost", message.GetHostname())
+
 }
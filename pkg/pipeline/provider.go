@@ -35,6 +35,9 @@ func NewPipelineProvider() *PipelineProvider {
 // Start initializes the pipelines
 func (pp *PipelineProvider) Start(cm *sender.ConnectionManager, auditorChan chan message.Message) {
 
+	// the rate limits apply to the messages of a source in all the pipelines,
+	// the first processor reports the messages dropped
+	limiters := processor.NewSourceLimiters()
 	for i := int32(0); i < pp.numberOfPipelines; i++ {
 
 		senderChan := make(chan message.Message, pp.chanSizes)
@@ -47,6 +50,8 @@ func (pp *PipelineProvider) Start(cm *sender.ConnectionManager, auditorChan chan
 			senderChan,
 			config.LogsAgent.GetString("api_key"),
 			config.LogsAgent.GetString("logset"),
+			limiters,
+			i == 0,
 		)
 		p.Start()
 
@@ -0,0 +1,165 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"sort"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/DataDog/datadog-log-agent/pkg/message"
+)
+
+// dedupeFlushPeriod is the period of the checks of the repeats of the idle origins
+const dedupeFlushPeriod = time.Second
+
+// dedupeConsecutiveWindow is the maximum time consecutive identical lines
+// are collapsed before their repeats are reported
+const dedupeConsecutiveWindow = 10 * time.Second
+
+// dedupeMaxEntries is the maximum number of distinct lines tracked by source,
+// other lines are sent as is
+const dedupeMaxEntries = 1000
+
+// repeatedMessage is the last repeat of a line, with the number of repeats suppressed
+type repeatedMessage struct {
+	msg     message.Message
+	content []byte
+	repeats int
+}
+
+// dedupeEntry tracks the repeats of a line sent at firstSeen
+type dedupeEntry struct {
+	firstSeen time.Time
+	repeatedMessage
+}
+
+// originKey identifies the messages of a source coming from the same origin,
+// such as a file or a container, which go through the same pipeline in order.
+// The messages of the connections of a network source have no identifier
+type originKey struct {
+	source     *config.IntegrationConfigLogSource
+	identifier string
+}
+
+// sourceDeduper suppresses the lines of an origin identical to a line sent within the window,
+// or to the previous line in consecutive mode
+type sourceDeduper struct {
+	window      time.Duration
+	consecutive bool
+	entries     map[string]*dedupeEntry
+	lastSeen    time.Time
+	lastMsg     message.Message
+}
+
+// newSourceDeduper returns a sourceDeduper applying rule
+func newSourceDeduper(rule config.LogsProcessingRule) *sourceDeduper {
+	d := &sourceDeduper{
+		window:  time.Duration(rule.Window) * time.Second,
+		entries: make(map[string]*dedupeEntry),
+	}
+	if d.window == 0 {
+		d.window = dedupeConsecutiveWindow
+		d.consecutive = true
+	}
+	return d
+}
+
+// dedupe returns true if content repeats a line and must be suppressed,
+// along with the repeats to send before it: the lines whose window is over,
+// and in consecutive mode the line ended by content
+func (d *sourceDeduper) dedupe(msg message.Message, content []byte, now time.Time) (bool, []repeatedMessage) {
+	key := string(content)
+	_, exists := d.entries[key]
+	ended := d.flush(now, d.consecutive && !exists)
+	d.lastSeen = now
+	d.lastMsg = msg
+	if entry, exists := d.entries[key]; exists {
+		entry.msg = msg
+		entry.content = content
+		entry.repeats++
+		return true, ended
+	}
+	if len(d.entries) < dedupeMaxEntries {
+		d.entries[key] = &dedupeEntry{firstSeen: now}
+	}
+	return false, ended
+}
+
+// flush removes the lines whose window is over, or all of them, and returns their repeats
+// in the order the lines were first seen. Only the offset of the last message of the origin is committed,
+// the repeats of the other lines were followed by newer messages whose offset was committed
+func (d *sourceDeduper) flush(now time.Time, all bool) []repeatedMessage {
+	entries := []*dedupeEntry{}
+	for key, entry := range d.entries {
+		if all || now.Sub(entry.firstSeen) >= d.window {
+			delete(d.entries, key)
+			if entry.repeats > 0 {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].firstSeen.Before(entries[j].firstSeen)
+	})
+	repeats := []repeatedMessage{}
+	for _, entry := range entries {
+		if entry.msg != d.lastMsg {
+			entry.msg.GetOrigin().Identifier = ""
+		}
+		repeats = append(repeats, entry.repeatedMessage)
+	}
+	return repeats
+}
+
+// sourceDedupers holds the dedupers of the origins whose source has a dedupe rule.
+// Each processor has its own, the messages of an origin going through a single pipeline
+type sourceDedupers struct {
+	dedupers map[originKey]*sourceDeduper
+}
+
+// newSourceDedupers returns a new sourceDedupers
+func newSourceDedupers() *sourceDedupers {
+	return &sourceDedupers{
+		dedupers: make(map[originKey]*sourceDeduper),
+	}
+}
+
+// dedupe returns true if the message with content must be suppressed by the dedupe rule of its source,
+// along with the repeats to send before it
+func (s *sourceDedupers) dedupe(msg message.Message, content []byte, now time.Time) (bool, []repeatedMessage) {
+	source := msg.GetOrigin().LogSource
+	key := originKey{source: source, identifier: msg.GetOrigin().Identifier}
+	deduper, exists := s.dedupers[key]
+	if !exists {
+		for _, rule := range source.ProcessingRules {
+			if rule.Type == config.DEDUPE {
+				deduper = newSourceDeduper(rule)
+				s.dedupers[key] = deduper
+				break
+			}
+		}
+		if deduper == nil {
+			return false, nil
+		}
+	}
+	return deduper.dedupe(msg, content, now)
+}
+
+// takeRepeats returns the repeats of the origins which received no message since the window of a line was over,
+// or of all the lines of the origins idle since sourceIdleTimeout, and removes the dedupers tracking no more lines.
+// The repeats of the other origins are sent with their next message
+func (s *sourceDedupers) takeRepeats(now time.Time) []repeatedMessage {
+	repeats := []repeatedMessage{}
+	for key, deduper := range s.dedupers {
+		isIdle := now.Sub(deduper.lastSeen) > sourceIdleTimeout
+		repeats = append(repeats, deduper.flush(now, isIdle)...)
+		if len(deduper.entries) == 0 {
+			delete(s.dedupers, key)
+		}
+	}
+	return repeats
+}
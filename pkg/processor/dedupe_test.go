@@ -0,0 +1,184 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/DataDog/datadog-log-agent/pkg/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDedupeSource(window int) *config.IntegrationConfigLogSource {
+	rule := config.LogsProcessingRule{Type: config.DEDUPE, Name: "crash_loops", Window: window}
+	return &config.IntegrationConfigLogSource{ProcessingRules: []config.LogsProcessingRule{rule}, TagsPayload: []byte{'-'}}
+}
+
+func TestDedupeConsecutiveLines(t *testing.T) {
+	source := newDedupeSource(0)
+	d := newSourceDeduper(source.ProcessingRules[0])
+	now := time.Now()
+
+	isRepeat, repeats := d.dedupe(newNetworkMessage(nil, source), []byte("panic"), now)
+	assert.False(t, isRepeat)
+	assert.Equal(t, 0, len(repeats))
+
+	var last message.Message
+	for i := 0; i < 3; i++ {
+		last = newNetworkMessage(nil, source)
+		isRepeat, repeats = d.dedupe(last, []byte("panic"), now)
+		assert.True(t, isRepeat)
+		assert.Equal(t, 0, len(repeats))
+	}
+
+	// a different line ends the repeats
+	isRepeat, repeats = d.dedupe(newNetworkMessage(nil, source), []byte("restarting"), now)
+	assert.False(t, isRepeat)
+	assert.Equal(t, 1, len(repeats))
+	assert.Equal(t, 3, repeats[0].repeats)
+	assert.Equal(t, "panic", string(repeats[0].content))
+	assert.Equal(t, last, repeats[0].msg)
+
+	// the same line is sent again after a different one
+	isRepeat, repeats = d.dedupe(newNetworkMessage(nil, source), []byte("panic"), now)
+	assert.False(t, isRepeat)
+	assert.Equal(t, 0, len(repeats))
+}
+
+func TestDedupeLinesWithinWindow(t *testing.T) {
+	source := newDedupeSource(60)
+	d := newSourceDeduper(source.ProcessingRules[0])
+	now := time.Now()
+
+	isRepeat, _ := d.dedupe(newNetworkMessage(nil, source), []byte("panic"), now)
+	assert.False(t, isRepeat)
+	isRepeat, _ = d.dedupe(newNetworkMessage(nil, source), []byte("restarting"), now.Add(time.Second))
+	assert.False(t, isRepeat)
+	isRepeat, _ = d.dedupe(newNetworkMessage(nil, source), []byte("panic"), now.Add(30*time.Second))
+	assert.True(t, isRepeat)
+	isRepeat, _ = d.dedupe(newNetworkMessage(nil, source), []byte("restarting"), now.Add(30*time.Second))
+	assert.True(t, isRepeat)
+	isRepeat, _ = d.dedupe(newNetworkMessage(nil, source), []byte("panic"), now.Add(40*time.Second))
+	assert.True(t, isRepeat)
+
+	assert.Equal(t, 0, len(d.flush(now.Add(59*time.Second), false)))
+	repeats := d.flush(now.Add(time.Minute+time.Second), false)
+	assert.Equal(t, 2, len(repeats))
+	assert.Equal(t, "panic", string(repeats[0].content))
+	assert.Equal(t, 2, repeats[0].repeats)
+	assert.Equal(t, "restarting", string(repeats[1].content))
+	assert.Equal(t, 1, repeats[1].repeats)
+	assert.Equal(t, 0, len(d.entries))
+
+	// a line seen after the window of its first occurrence is sent
+	isRepeat, _ = d.dedupe(newNetworkMessage(nil, source), []byte("panic"), now.Add(time.Minute+time.Second))
+	assert.False(t, isRepeat)
+	isRepeat, repeats = d.dedupe(newNetworkMessage(nil, source), []byte("panic"), now.Add(2*time.Minute+time.Second))
+	assert.False(t, isRepeat)
+	assert.Equal(t, 0, len(repeats))
+}
+
+func TestSourceDedupersTakeRepeats(t *testing.T) {
+	source := newDedupeSource(0)
+	withoutRule := &config.IntegrationConfigLogSource{TagsPayload: []byte{'-'}}
+	s := newSourceDedupers()
+	now := time.Now()
+
+	isRepeat, _ := s.dedupe(newNetworkMessage(nil, withoutRule), []byte("panic"), now)
+	assert.False(t, isRepeat)
+	isRepeat, _ = s.dedupe(newNetworkMessage(nil, withoutRule), []byte("panic"), now)
+	assert.False(t, isRepeat)
+	assert.Equal(t, 0, len(s.dedupers))
+
+	s.dedupe(newNetworkMessage(nil, source), []byte("panic"), now)
+	isRepeat, _ = s.dedupe(newNetworkMessage(nil, source), []byte("panic"), now)
+	assert.True(t, isRepeat)
+	assert.Equal(t, 0, len(s.takeRepeats(now)))
+	repeats := s.takeRepeats(now.Add(dedupeConsecutiveWindow))
+	assert.Equal(t, 1, len(repeats))
+	assert.Equal(t, 1, repeats[0].repeats)
+	assert.Equal(t, 0, len(s.dedupers))
+}
+
+func TestSourceDedupersDedupeOrigins(t *testing.T) {
+	source := newDedupeSource(0)
+	s := newSourceDedupers()
+	now := time.Now()
+
+	for _, identifier := range []string{"file:/var/log/a.log", "file:/var/log/b.log"} {
+		msg := newNetworkMessage(nil, source)
+		msg.GetOrigin().Identifier = identifier
+		isRepeat, _ := s.dedupe(msg, []byte("panic"), now)
+		assert.False(t, isRepeat)
+	}
+	assert.Equal(t, 2, len(s.dedupers))
+}
+
+func TestDedupeCommitsTheOffsetOfTheLastMessage(t *testing.T) {
+	source := newDedupeSource(60)
+	d := newSourceDeduper(source.ProcessingRules[0])
+	now := time.Now()
+	newMessage := func() message.Message {
+		msg := newNetworkMessage(nil, source)
+		msg.GetOrigin().Identifier = "file:/var/log/app.log"
+		return msg
+	}
+
+	d.dedupe(newMessage(), []byte("panic"), now)
+	d.dedupe(newMessage(), []byte("restarting"), now.Add(time.Second))
+	d.dedupe(newMessage(), []byte("panic"), now.Add(2*time.Second))
+	d.dedupe(newMessage(), []byte("restarting"), now.Add(3*time.Second))
+
+	// the repeat of panic was followed by a newer message
+	repeats := d.flush(now.Add(time.Hour), true)
+	assert.Equal(t, 2, len(repeats))
+	assert.Equal(t, "", repeats[0].msg.GetOrigin().Identifier)
+	assert.Equal(t, "file:/var/log/app.log", repeats[1].msg.GetOrigin().Identifier)
+}
+
+func TestSourceDedupersRemoveIdleDedupers(t *testing.T) {
+	source := newDedupeSource(3600)
+	s := newSourceDedupers()
+	now := time.Now()
+
+	s.dedupe(newNetworkMessage(nil, source), []byte("panic"), now)
+	s.dedupe(newNetworkMessage(nil, source), []byte("panic"), now)
+	assert.Equal(t, 0, len(s.takeRepeats(now.Add(sourceIdleTimeout))))
+	assert.Equal(t, 1, len(s.dedupers))
+
+	// the repeats of an idle source are sent before its deduper is removed
+	repeats := s.takeRepeats(now.Add(sourceIdleTimeout + time.Second))
+	assert.Equal(t, 1, len(repeats))
+	assert.Equal(t, 1, repeats[0].repeats)
+	assert.Equal(t, 0, len(s.dedupers))
+}
+
+func TestProcessorSendsRepeats(t *testing.T) {
+	outputChan := make(chan message.Message, 10)
+	p := New(nil, outputChan, "apikey", "", NewSourceLimiters(), false)
+	source := newDedupeSource(0)
+	for i, content := range []string{"panic", "panic", "panic", "restarting"} {
+		msg := newNetworkMessage([]byte(content), source)
+		msg.GetOrigin().Identifier = "file:/var/log/app.log"
+		msg.GetOrigin().Offset = int64(i)
+		p.process(msg)
+	}
+	assert.Equal(t, 3, len(outputChan))
+	msg := <-outputChan
+	assert.True(t, strings.HasSuffix(string(msg.Content()), " - panic\n"))
+	assert.Equal(t, "file:/var/log/app.log", msg.GetOrigin().Identifier)
+	// the repeats are sent before the next line, with their offset
+	msg = <-outputChan
+	assert.True(t, strings.HasSuffix(string(msg.Content()), " - panic (repeated 2 times)\n"))
+	assert.Equal(t, "file:/var/log/app.log", msg.GetOrigin().Identifier)
+	assert.Equal(t, int64(2), msg.GetOrigin().Offset)
+	msg = <-outputChan
+	assert.True(t, strings.HasSuffix(string(msg.Content()), " - restarting\n"))
+	assert.Equal(t, int64(3), msg.GetOrigin().Offset)
+}
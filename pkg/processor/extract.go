@@ -0,0 +1,45 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"strings"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/DataDog/datadog-log-agent/pkg/message"
+)
+
+// applyExtractionRules adds the fields captured by the named groups of the extract rules matching content
+// to the message, as a structured data element named after the rule or as tags
+func applyExtractionRules(msg message.Message, content []byte) {
+	for _, rule := range msg.GetOrigin().LogSource.ProcessingRules {
+		if rule.Type != config.EXTRACT {
+			continue
+		}
+		submatches := rule.Reg.FindSubmatch(content)
+		if submatches == nil {
+			continue
+		}
+		fields := make(map[string]interface{})
+		tags := []string{}
+		for i, name := range rule.Reg.SubexpNames() {
+			// groups not taking part in the match are skipped
+			if name == "" || submatches[i] == nil {
+				continue
+			}
+			fields[name] = string(submatches[i])
+			tags = append(tags, name+":"+string(submatches[i]))
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if rule.ExtractTo == config.EXTRACT_TO_TAGS {
+			addTagsPayload(msg, []byte(`[dd ddtags="`+sdValue(strings.Join(tags, ","))+`"]`))
+		} else {
+			addTagsPayload(msg, structuredData(sdName(rule.Name), fields))
+		}
+	}
+}
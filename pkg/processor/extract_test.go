@@ -0,0 +1,44 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newExtractSource(extractTo string, tagsPayload string) *config.IntegrationConfigLogSource {
+	rule := config.LogsProcessingRule{
+		Type:      config.EXTRACT,
+		Name:      "nginx",
+		Reg:       regexp.MustCompile(`" (?P<status>\d{3}) (?P<bytes>\d+)(?: (?P<duration>[\d.]+))?$`),
+		ExtractTo: extractTo,
+	}
+	return &config.IntegrationConfigLogSource{ProcessingRules: []config.LogsProcessingRule{rule}, TagsPayload: []byte(tagsPayload)}
+}
+
+func TestExtractToStructuredData(t *testing.T) {
+	source := newExtractSource("", `[dd ddsource="nginx"]`)
+	msg := newNetworkMessage(nil, source)
+	applyExtractionRules(msg, []byte(`"GET / HTTP/1.1" 200 512 0.25`))
+	assert.Equal(t, `[dd ddsource="nginx"][nginx bytes="512" duration="0.25" status="200"]`, string(msg.GetTagsPayload()))
+	assert.Equal(t, `[dd ddsource="nginx"]`, string(source.TagsPayload))
+}
+
+func TestExtractToTags(t *testing.T) {
+	msg := newNetworkMessage(nil, newExtractSource(config.EXTRACT_TO_TAGS, "-"))
+	applyExtractionRules(msg, []byte(`"GET / HTTP/1.1" 404 0`))
+	assert.Equal(t, `[dd ddtags="status:404,bytes:0"]`, string(msg.GetTagsPayload()))
+}
+
+func TestExtractWithoutMatch(t *testing.T) {
+	msg := newNetworkMessage(nil, newExtractSource("", "-"))
+	applyExtractionRules(msg, []byte("hello"))
+	assert.Equal(t, "-", string(msg.GetTagsPayload()))
+}
@@ -0,0 +1,179 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/DataDog/datadog-log-agent/pkg/message"
+)
+
+// fieldsSDID is the id of the structured data element holding the fields of json logs
+const fieldsSDID = "fields"
+
+// sdNameMaxLen is the maximum length of the name of a structured data parameter
+const sdNameMaxLen = 32
+
+// parseJSON extracts the fields of content when it's a JSON object:
+// message becomes the content, level or severity, timestamp and service
+// go to the header of the message, and the other fields are sent as structured data.
+// Content that is not a JSON object is sent as is
+func parseJSON(msg message.Message, content []byte) []byte {
+	fields, ok := decodeJSONObject(content)
+	if !ok {
+		return content
+	}
+
+	for _, key := range []string{"level", "severity"} {
+		if level, ok := fields[key].(string); ok {
+			if severity := config.SeverityFromLevel(level); severity != nil {
+				msg.SetSeverity(severity)
+				delete(fields, key)
+				break
+			}
+		}
+	}
+	if timestamp, ok := parseJSONTimestamp(fields["timestamp"]); ok {
+		msg.SetTimestamp(timestamp)
+		delete(fields, "timestamp")
+	}
+	if service, ok := fields["service"].(string); ok && service != "" {
+		msg.SetService(service)
+		delete(fields, "service")
+	}
+
+	text, ok := fields["message"].(string)
+	if !ok {
+		// without message, the whole object remains the content
+		return content
+	}
+	delete(fields, "message")
+	if len(fields) > 0 {
+		addTagsPayload(msg, structuredData(fieldsSDID, fields))
+	}
+	// the message can't span several lines
+	return []byte(strings.Replace(text, "\n", `\n`, -1))
+}
+
+// decodeJSONObject returns the fields of content if it's exactly one JSON object
+func decodeJSONObject(content []byte) (map[string]interface{}, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil || fields == nil {
+		return nil, false
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		// trailing data
+		return nil, false
+	}
+	return fields, true
+}
+
+// parseJSONTimestamp returns the timestamp formatted as config.DateFormat
+// from either a RFC3339 date or an epoch in seconds or milliseconds
+func parseJSONTimestamp(value interface{}) (string, bool) {
+	var timestamp time.Time
+	switch v := value.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return "", false
+		}
+		timestamp = t
+	case json.Number:
+		epoch, err := v.Float64()
+		if err != nil || epoch <= 0 {
+			return "", false
+		}
+		unit := time.Second
+		if epoch > 1e12 {
+			unit = time.Millisecond
+		}
+		if integer, err := v.Int64(); err == nil {
+			// avoid floating point rounding
+			timestamp = time.Unix(0, integer*int64(unit))
+		} else {
+			timestamp = time.Unix(0, int64(epoch*float64(unit)))
+		}
+	default:
+		return "", false
+	}
+	return timestamp.UTC().Format(config.DateFormat), true
+}
+
+// structuredData returns fields as a RFC5424 structured data element,
+// nested objects are flattened with dotted names
+func structuredData(id string, fields map[string]interface{}) []byte {
+	params := make(map[string]string)
+	flattenFields("", fields, params)
+	names := []string{}
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sd := []byte("[" + id)
+	for _, name := range names {
+		sd = append(sd, ' ')
+		sd = append(sd, []byte(sdName(name))...)
+		sd = append(sd, '=', '"')
+		sd = append(sd, []byte(sdValue(params[name]))...)
+		sd = append(sd, '"')
+	}
+	return append(sd, ']')
+}
+
+// flattenFields adds the fields to params as strings
+func flattenFields(prefix string, fields map[string]interface{}, params map[string]string) {
+	for key, value := range fields {
+		name := prefix + key
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenFields(name+".", v, params)
+		case string:
+			params[name] = v
+		case json.Number:
+			params[name] = v.String()
+		case bool:
+			params[name] = strconv.FormatBool(v)
+		case nil:
+			params[name] = "null"
+		default:
+			encoded, _ := json.Marshal(v)
+			params[name] = string(encoded)
+		}
+	}
+}
+
+// sdName returns a valid structured data parameter name
+func sdName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+	if len(name) > sdNameMaxLen {
+		name = name[:sdNameMaxLen]
+	}
+	return name
+}
+
+// sdValue escapes the characters that must be escaped in a structured data parameter value
+func sdValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	value = strings.Replace(value, `]`, `\]`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
@@ -0,0 +1,72 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSON(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Service: "sourceService", LogFormat: config.LOG_FORMAT_JSON, TagsPayload: []byte("[dd ddtags=\"env:prod\"]")}
+	msg := newNetworkMessage(nil, source)
+	content := parseJSON(msg, []byte(`{"message":"hello\nworld","level":"WARN","timestamp":"2017-10-16T12:00:00.5+02:00","service":"app","user":{"id":42,"name":"bob"},"ok":true}`))
+	assert.Equal(t, `hello\nworld`, string(content))
+	assert.Equal(t, config.SEV_WARNING, msg.GetSeverity())
+	assert.Equal(t, "2017-10-16T10:00:00.500000000Z", msg.GetTimestamp())
+	assert.Equal(t, "app", msg.GetService())
+	assert.Equal(t, `[dd ddtags="env:prod"][fields ok="true" user.id="42" user.name="bob"]`, string(msg.GetTagsPayload()))
+	assert.Equal(t, "[dd ddtags=\"env:prod\"]", string(source.TagsPayload))
+}
+
+func TestParseJSONWithoutMessage(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Service: "sourceService", LogFormat: config.LOG_FORMAT_JSON, TagsPayload: []byte{'-'}}
+	msg := newNetworkMessage(nil, source)
+	content := parseJSON(msg, []byte(`{"severity":"error","timestamp":1508148000,"user":"bob"}`))
+	assert.Equal(t, `{"severity":"error","timestamp":1508148000,"user":"bob"}`, string(content))
+	assert.Equal(t, config.SEV_ERROR, msg.GetSeverity())
+	assert.Equal(t, "2017-10-16T10:00:00.000000000Z", msg.GetTimestamp())
+	assert.Equal(t, "sourceService", msg.GetService())
+	assert.Equal(t, "-", string(msg.GetTagsPayload()))
+}
+
+func TestParseJSONKeepsUnknownValues(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{LogFormat: config.LOG_FORMAT_JSON, TagsPayload: []byte{'-'}}
+	msg := newNetworkMessage(nil, source)
+	content := parseJSON(msg, []byte(`{"message":"hello","level":"verbose","timestamp":"yesterday"}`))
+	assert.Equal(t, "hello", string(content))
+	assert.Nil(t, msg.GetSeverity())
+	assert.Equal(t, "", msg.GetTimestamp())
+	assert.Equal(t, `[fields level="verbose" timestamp="yesterday"]`, string(msg.GetTagsPayload()))
+}
+
+func TestParseMalformedJSON(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{LogFormat: config.LOG_FORMAT_JSON, TagsPayload: []byte{'-'}}
+	for _, content := range []string{"hello world", `{"message":"hello"`, `{"message":"hello"} trailing`, `["hello"]`, "null"} {
+		msg := newNetworkMessage(nil, source)
+		assert.Equal(t, content, string(parseJSON(msg, []byte(content))))
+		assert.Nil(t, msg.GetSeverity())
+		assert.Equal(t, "-", string(msg.GetTagsPayload()))
+	}
+}
+
+func TestParseJSONTimestamp(t *testing.T) {
+	timestamp, ok := parseJSONTimestamp(json.Number("1508148000123"))
+	assert.True(t, ok)
+	assert.Equal(t, "2017-10-16T10:00:00.123000000Z", timestamp)
+	_, ok = parseJSONTimestamp(json.Number("-1"))
+	assert.False(t, ok)
+	_, ok = parseJSONTimestamp(true)
+	assert.False(t, ok)
+}
+
+func TestStructuredData(t *testing.T) {
+	fields := map[string]interface{}{"a key": `quote " and ]`, "list": []interface{}{"a", json.Number("1")}, "empty": nil}
+	assert.Equal(t, `[fields a_key="quote \" and \]" empty="null" list="[\"a\",1\]"]`, string(structuredData(fieldsSDID, fields)))
+}
@@ -0,0 +1,146 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"expvar"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+)
+
+// dropSummaryPeriod is the period of the messages reporting the messages dropped by rate limit
+const dropSummaryPeriod = time.Minute
+
+// sourceIdleTimeout is the time after which the state kept for a source that sends no message is removed
+const sourceIdleTimeout = 10 * time.Minute
+
+// processorExpvars counts the messages affected by the options of the sources:
+// RateLimitedMessages are dropped above their rate_limit, SampledOutMessages by their sample_rate,
+// and FutureTimestamps have a timestamp too far in the future, ignored by the timestamp rules
+var processorExpvars = expvar.NewMap("processor")
+
+// sourceLimiter samples the messages of a source and limits their rate with a token bucket
+type sourceLimiter struct {
+	rate       float64
+	burst      float64
+	sampleRate float64
+	tokens     float64
+	lastSeen   time.Time
+	dropped    int64
+	random     func() float64
+}
+
+// newSourceLimiter returns a sourceLimiter for the rate_limit, rate_limit_burst and sample_rate of source,
+// or nil if the source has none
+func newSourceLimiter(source *config.IntegrationConfigLogSource, now time.Time) *sourceLimiter {
+	if source.RateLimit == 0 && (source.SampleRate == 0 || source.SampleRate == 1) {
+		return nil
+	}
+	burst := float64(source.RateLimitBurst)
+	if burst == 0 {
+		burst = math.Max(1, math.Ceil(source.RateLimit))
+	}
+	return &sourceLimiter{
+		rate:       source.RateLimit,
+		burst:      burst,
+		sampleRate: source.SampleRate,
+		tokens:     burst,
+		lastSeen:   now,
+		random:     rand.Float64,
+	}
+}
+
+// allow returns true if the message received at now is sampled and under the rate limit
+func (l *sourceLimiter) allow(now time.Time) bool {
+	elapsed := now.Sub(l.lastSeen).Seconds()
+	l.lastSeen = now
+	if l.sampleRate > 0 && l.sampleRate < 1 && l.random() >= l.sampleRate {
+		processorExpvars.Add("SampledOutMessages", 1)
+		return false
+	}
+	if l.rate == 0 {
+		return true
+	}
+	if elapsed > 0 {
+		l.tokens = math.Min(l.burst, l.tokens+elapsed*l.rate)
+	}
+	if l.tokens < 1 {
+		l.dropped++
+		processorExpvars.Add("RateLimitedMessages", 1)
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// SourceLimiters holds the limiters of the sources having a rate_limit or a sample_rate,
+// shared by all the processors since the messages of a source can go through several pipelines
+type SourceLimiters struct {
+	mutex    sync.Mutex
+	limiters map[*config.IntegrationConfigLogSource]*sourceLimiter
+}
+
+// NewSourceLimiters returns a new SourceLimiters
+func NewSourceLimiters() *SourceLimiters {
+	return &SourceLimiters{
+		limiters: make(map[*config.IntegrationConfigLogSource]*sourceLimiter),
+	}
+}
+
+// allow returns true if the message of source received at now should be sent
+func (s *SourceLimiters) allow(source *config.IntegrationConfigLogSource, now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	limiter, exists := s.limiters[source]
+	if !exists {
+		limiter = newSourceLimiter(source, now)
+		if limiter == nil {
+			return true
+		}
+		s.limiters[source] = limiter
+	}
+	return limiter.allow(now)
+}
+
+// takeDropped returns the number of messages dropped by rate limit for each source since the last call,
+// and removes the limiters of the sources idle since sourceIdleTimeout
+func (s *SourceLimiters) takeDropped(now time.Time) map[*config.IntegrationConfigLogSource]int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	dropped := make(map[*config.IntegrationConfigLogSource]int64)
+	for source, limiter := range s.limiters {
+		if limiter.dropped > 0 {
+			dropped[source] = limiter.dropped
+			limiter.dropped = 0
+		} else if now.Sub(limiter.lastSeen) > sourceIdleTimeout {
+			delete(s.limiters, source)
+		}
+	}
+	return dropped
+}
+
+// dropSummary returns the content of the message reporting the messages of source dropped by rate limit
+func dropSummary(source *config.IntegrationConfigLogSource, dropped int64) string {
+	var name string
+	switch source.Type {
+	case config.TCP_TYPE, config.UDP_TYPE:
+		name = fmt.Sprintf("%s:%d", source.Type, source.Port)
+	case config.DOCKER_TYPE:
+		if source.Image != "" {
+			name = fmt.Sprintf("%s:%s", source.Type, source.Image)
+		} else {
+			name = fmt.Sprintf("%s:%s", source.Type, source.Label)
+		}
+	default:
+		name = fmt.Sprintf("%s:%s", source.Type, source.Path)
+	}
+	return fmt.Sprintf("%d messages dropped by rate limit for source %s", dropped, name)
+}
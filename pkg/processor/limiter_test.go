@@ -0,0 +1,117 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/DataDog/datadog-log-agent/pkg/message"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourceLimiterRateLimit(t *testing.T) {
+	now := time.Now()
+	limiter := newSourceLimiter(&config.IntegrationConfigLogSource{RateLimit: 2, RateLimitBurst: 3}, now)
+
+	// the burst is sent at once
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.allow(now))
+	}
+	assert.False(t, limiter.allow(now))
+
+	// then rate_limit messages per second
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, limiter.allow(now))
+	assert.False(t, limiter.allow(now))
+	assert.Equal(t, int64(2), limiter.dropped)
+
+	// the burst is available again after a quiet period
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.True(t, limiter.allow(now))
+	}
+	assert.False(t, limiter.allow(now))
+}
+
+func TestSourceLimiterDefaultBurst(t *testing.T) {
+	now := time.Now()
+	limiter := newSourceLimiter(&config.IntegrationConfigLogSource{RateLimit: 0.5}, now)
+	assert.True(t, limiter.allow(now))
+	assert.False(t, limiter.allow(now.Add(time.Second)))
+	assert.True(t, limiter.allow(now.Add(2*time.Second)))
+}
+
+func TestSourceLimiterSampleRate(t *testing.T) {
+	now := time.Now()
+	limiter := newSourceLimiter(&config.IntegrationConfigLogSource{SampleRate: 0.25}, now)
+	randoms := []float64{0.1, 0.5, 0.9, 0.24, 0.25}
+	limiter.random = func() float64 {
+		random := randoms[0]
+		randoms = randoms[1:]
+		return random
+	}
+	allowed := []bool{}
+	for range randoms {
+		allowed = append(allowed, limiter.allow(now))
+	}
+	assert.Equal(t, []bool{true, false, false, true, false}, allowed)
+	assert.Equal(t, int64(0), limiter.dropped)
+}
+
+func TestSourceLimiterNotNeeded(t *testing.T) {
+	assert.Nil(t, newSourceLimiter(&config.IntegrationConfigLogSource{}, time.Now()))
+	assert.Nil(t, newSourceLimiter(&config.IntegrationConfigLogSource{SampleRate: 1}, time.Now()))
+}
+
+func TestSourceLimitersTakeDropped(t *testing.T) {
+	now := time.Now()
+	limited := &config.IntegrationConfigLogSource{RateLimit: 1}
+	idle := &config.IntegrationConfigLogSource{RateLimit: 1}
+	unlimited := &config.IntegrationConfigLogSource{}
+	l := NewSourceLimiters()
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.allow(unlimited, now))
+	}
+	assert.True(t, l.allow(idle, now))
+	assert.True(t, l.allow(limited, now))
+	assert.False(t, l.allow(limited, now))
+	assert.Equal(t, 2, len(l.limiters))
+
+	assert.Equal(t, map[*config.IntegrationConfigLogSource]int64{limited: 1}, l.takeDropped(now))
+	assert.Equal(t, map[*config.IntegrationConfigLogSource]int64{}, l.takeDropped(now))
+
+	l.allow(limited, now.Add(sourceIdleTimeout))
+	l.takeDropped(now.Add(sourceIdleTimeout + time.Second))
+	assert.Equal(t, 1, len(l.limiters))
+	assert.NotNil(t, l.limiters[limited])
+}
+
+func TestProcessorSendsDropSummaries(t *testing.T) {
+	outputChan := make(chan message.Message, 10)
+	limiters := NewSourceLimiters()
+	p := New(nil, outputChan, "apikey", "", limiters, true)
+	other := New(nil, outputChan, "apikey", "", limiters, false)
+	source := &config.IntegrationConfigLogSource{Type: config.TCP_TYPE, Port: 10514, RateLimit: 1, TagsPayload: []byte(`[dd ddsource="app"]`)}
+	for i := 0; i < 3; i++ {
+		p.process(newNetworkMessage([]byte("hello"), source))
+	}
+	// the rate limit applies to the messages of the source in all the pipelines
+	other.process(newNetworkMessage([]byte("hello"), source))
+	assert.Equal(t, 1, len(outputChan))
+	<-outputChan
+
+	// only one processor sends the summaries
+	other.sendDropSummaries()
+	assert.Equal(t, 0, len(outputChan))
+	p.sendDropSummaries()
+	assert.Equal(t, 1, len(outputChan))
+	summary := string((<-outputChan).Content())
+	assert.True(t, strings.HasPrefix(summary, "apikey <44>0 "))
+	assert.True(t, strings.HasSuffix(summary, ` [dd ddsource="app"] 3 messages dropped by rate limit for source tcp:10514`+"\n"))
+}
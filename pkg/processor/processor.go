@@ -6,6 +6,7 @@
 package processor
 
 import (
+	"bytes"
 	"fmt"
 	"time"
 
@@ -21,10 +22,18 @@ type Processor struct {
 	apikey       string
 	logset       string
 	apikeyString []byte
+
+	// the limiters are shared by the processors, only one of them sends the drop summaries
+	limiters           *SourceLimiters
+	sendsDropSummaries bool
+
+	dedupers   *sourceDedupers
+	timestamps *sourceTimestamps
 }
 
-// New returns an initialized Processor
-func New(inputChan, outputChan chan message.Message, apikey, logset string) *Processor {
+// New returns an initialized Processor applying the rate limits of limiters,
+// which sends the summaries of the messages they dropped if sendsDropSummaries is true
+func New(inputChan, outputChan chan message.Message, apikey, logset string, limiters *SourceLimiters, sendsDropSummaries bool) *Processor {
 	var apikeyString string
 	if logset != "" {
 		apikeyString = fmt.Sprintf("%s/%s", apikey, logset)
@@ -37,6 +46,12 @@ func New(inputChan, outputChan chan message.Message, apikey, logset string) *Pro
 		apikey:       apikey,
 		logset:       logset,
 		apikeyString: []byte(apikeyString),
+
+		limiters:           limiters,
+		sendsDropSummaries: sendsDropSummaries,
+
+		dedupers:   newSourceDedupers(),
+		timestamps: newSourceTimestamps(),
 	}
 }
 
@@ -45,27 +60,103 @@ func (p *Processor) Start() {
 	go p.run()
 }
 
-// run starts the processing of the inputChan
+// run starts the processing of the inputChan,
+// and periodically reports the messages dropped by rate limit
 func (p *Processor) run() {
-	for msg := range p.inputChan {
-		shouldProcess, redactedMessage := p.applyRedactingRules(msg)
-		if shouldProcess {
-			extraContent := p.computeExtraContent(msg)
-			apikeyString := p.computeApiKeyString(msg)
-			payload := p.buildPayload(apikeyString, redactedMessage, extraContent)
-			msg.SetContent(payload)
-			p.outputChan <- msg
+	dropSummaryTicker := time.NewTicker(dropSummaryPeriod)
+	defer dropSummaryTicker.Stop()
+	dedupeTicker := time.NewTicker(dedupeFlushPeriod)
+	defer dedupeTicker.Stop()
+	for {
+		select {
+		case msg, isOpen := <-p.inputChan:
+			if !isOpen {
+				return
+			}
+			p.process(msg)
+		case <-dropSummaryTicker.C:
+			p.sendDropSummaries()
+		case <-dedupeTicker.C:
+			p.sendRepeats(p.dedupers.takeRepeats(time.Now()))
 		}
 	}
 }
 
+// process sends msg to the outputChan unless it's filtered out by the rules,
+// suppressed as a repeat, or dropped by the rate limit or the sampling of its source
+func (p *Processor) process(msg message.Message) {
+	shouldProcess, redactedMessage := p.applyRedactingRules(msg)
+	if !shouldProcess {
+		return
+	}
+	isRepeat, endedRepeats := p.dedupers.dedupe(msg, redactedMessage, time.Now())
+	p.sendRepeats(endedRepeats)
+	if isRepeat || !p.limiters.allow(msg.GetOrigin().LogSource, time.Now()) {
+		return
+	}
+	p.format(msg, redactedMessage, 0)
+}
+
+// sendRepeats sends the last repeat of the lines suppressed by a dedupe rule,
+// annotated with their number of repeats
+func (p *Processor) sendRepeats(repeats []repeatedMessage) {
+	for _, repeat := range repeats {
+		p.format(repeat.msg, repeat.content, repeat.repeats)
+	}
+}
+
+// format parses content in the log format of the source of msg, applies the severity, timestamp and extract rules,
+// annotates it with the number of times it was repeated if any, and sends it
+func (p *Processor) format(msg message.Message, content []byte, repeats int) {
+	switch msg.GetOrigin().LogSource.LogFormat {
+	case config.LOG_FORMAT_JSON:
+		content = parseJSON(msg, content)
+	case config.LOG_FORMAT_SYSLOG:
+		content = parseSyslog(msg, content)
+	}
+	applySeverityRules(msg, content)
+	applyTimestampRules(msg, content, time.Now(), p.timestamps)
+	applyExtractionRules(msg, content)
+	if repeats > 0 {
+		content = append(append([]byte{}, content...), []byte(fmt.Sprintf(" (repeated %d times)", repeats))...)
+	}
+	p.send(msg, content)
+}
+
+// send formats msg with content and sends it to the outputChan
+func (p *Processor) send(msg message.Message, content []byte) {
+	extraContent := p.computeExtraContent(msg)
+	apikeyString := p.computeApiKeyString(msg)
+	payload := p.buildPayload(apikeyString, content, extraContent)
+	msg.SetContent(payload)
+	p.outputChan <- msg
+}
+
+// sendDropSummaries sends a warning to the sources whose messages were dropped by rate limit,
+// with their service and tags. Only the processor sending the drop summaries sends it
+func (p *Processor) sendDropSummaries() {
+	if !p.sendsDropSummaries {
+		return
+	}
+	for source, dropped := range p.limiters.takeDropped(time.Now()) {
+		msg := message.NewNetworkMessage([]byte(dropSummary(source, dropped)))
+		origin := message.NewOrigin()
+		origin.LogSource = source
+		msg.SetOrigin(origin)
+		msg.SetSeverity(config.SEV_WARNING)
+		p.send(msg, msg.Content())
+	}
+}
+
 // computeExtraContent returns additional content to add to a log line.
 // For instance, we want to add the timestamp, hostname and a log level
 // to messages coming from a file
 func (p *Processor) computeExtraContent(msg message.Message) []byte {
 	// if the first char is '<', we can assume it's already formatted as RFC5424, thus skip this step
 	// (for instance, using tcp forwarding. We don't want to override the hostname & co)
-	if len(msg.Content()) > 0 && msg.Content()[0] != '<' {
+	// unless the source parses syslog messages, their fields are then kept in the message
+	isSyslog := msg.GetOrigin() != nil && msg.GetOrigin().LogSource != nil && msg.GetOrigin().LogSource.LogFormat == config.LOG_FORMAT_SYSLOG
+	if len(msg.Content()) > 0 && (msg.Content()[0] != '<' || isSyslog) {
 		// fit RFC5424
 		// <%pri%>%protocol-version% %timestamp:::date-rfc3339% %HOSTNAME% %$!new-appname% - - - %msg%\n
 		extraContent := []byte("")
@@ -91,11 +182,15 @@ func (p *Processor) computeExtraContent(msg message.Message) []byte {
 		extraContent = append(extraContent, ' ')
 
 		// Hostname
-		extraContent = append(extraContent, []byte(config.LogsAgent.GetString("hostname"))...)
+		hostname := msg.GetHostname()
+		if hostname == "" {
+			hostname = config.LogsAgent.GetString("hostname")
+		}
+		extraContent = append(extraContent, []byte(hostname)...)
 		extraContent = append(extraContent, ' ')
 
 		// Service
-		service := msg.GetOrigin().LogSource.Service
+		service := msg.GetService()
 		if service != "" {
 			extraContent = append(extraContent, []byte(service)...)
 		} else {
@@ -114,6 +209,16 @@ func (p *Processor) computeExtraContent(msg message.Message) []byte {
 	return nil
 }
 
+// addTagsPayload adds structured data elements after the tags payload of the message,
+// without changing the tags payload of its source
+func addTagsPayload(msg message.Message, payload []byte) {
+	tagsPayload := msg.GetTagsPayload()
+	if bytes.Equal(tagsPayload, []byte{'-'}) {
+		tagsPayload = nil
+	}
+	msg.SetTagsPayload(append(append([]byte{}, tagsPayload...), payload...))
+}
+
 func (p *Processor) computeApiKeyString(msg message.Message) []byte {
 	sourceLogset := msg.GetOrigin().LogSource.Logset
 	if sourceLogset != "" {
@@ -134,7 +239,10 @@ func (p *Processor) buildPayload(apikeyString, redactedMessage, extraContent []b
 }
 
 // applyRedactingRules returns given a message if we should process it or not,
-// and a copy of the message with some fields redacted, depending on config
+// and a copy of the message with some fields redacted, depending on config.
+// Rules are applied in order: exclude_at_match and include_at_match rules
+// see the content masked by the previous mask_sequences rules, and a message
+// must match all the include_at_match rules to be processed
 func (p *Processor) applyRedactingRules(msg message.Message) (bool, []byte) {
 	content := msg.Content()
 	for _, rule := range msg.GetOrigin().LogSource.ProcessingRules {
@@ -143,6 +251,10 @@ func (p *Processor) applyRedactingRules(msg message.Message) (bool, []byte) {
 			if rule.Reg.Match(content) {
 				return false, nil
 			}
+		case config.INCLUDE_AT_MATCH:
+			if !rule.Reg.Match(content) {
+				return false, nil
+			}
 		case config.MASK_SEQUENCES:
 			content = rule.Reg.ReplaceAllLiteral(content, rule.ReplacePlaceholderBytes)
 		}
@@ -18,7 +18,7 @@ import (
 )
 
 func NewTestProcessor() Processor {
-	return Processor{nil, nil, "", "", nil}
+	return Processor{nil, nil, "", "", nil, NewSourceLimiters(), false, newSourceDedupers(), newSourceTimestamps()}
 }
 
 func buildTestProcessingRule(ruleType, replacePlaceholder, pattern string, p *Processor) config.IntegrationConfigLogSource {
@@ -43,9 +43,9 @@ func newNetworkMessage(content []byte, source *config.IntegrationConfigLogSource
 
 func TestProcessor(t *testing.T) {
 	var p *Processor
-	p = New(nil, nil, "hello", "world")
+	p = New(nil, nil, "hello", "world", NewSourceLimiters(), false)
 	assert.Equal(t, "hello/world", string(p.apikeyString))
-	p = New(nil, nil, "helloworld", "")
+	p = New(nil, nil, "helloworld", "", NewSourceLimiters(), false)
 	assert.Equal(t, "helloworld", string(p.apikeyString))
 }
 
@@ -95,6 +95,62 @@ func TestMask(t *testing.T) {
 	assert.Equal(t, []byte("The credit card [masked_credit_card] was used to buy some time"), redactedMessage)
 }
 
+func TestInclusion(t *testing.T) {
+	p := NewTestProcessor()
+	var shouldProcess bool
+	var redactedMessage []byte
+
+	source := buildTestProcessingRule("include_at_match", "", "ERROR|WARN", &p)
+	shouldProcess, redactedMessage = p.applyRedactingRules(newNetworkMessage([]byte("[ERROR] disk full"), &source))
+	assert.Equal(t, true, shouldProcess)
+	assert.Equal(t, []byte("[ERROR] disk full"), redactedMessage)
+
+	shouldProcess, redactedMessage = p.applyRedactingRules(newNetworkMessage([]byte("[INFO] disk usage 42%"), &source))
+	assert.Equal(t, false, shouldProcess)
+	assert.Nil(t, redactedMessage)
+}
+
+func TestChainedRules(t *testing.T) {
+	p := NewTestProcessor()
+	var shouldProcess bool
+	var redactedMessage []byte
+
+	newRule := func(ruleType, replacePlaceholder, pattern string) config.LogsProcessingRule {
+		return buildTestProcessingRule(ruleType, replacePlaceholder, pattern, &p).ProcessingRules[0]
+	}
+	source := config.IntegrationConfigLogSource{
+		ProcessingRules: []config.LogsProcessingRule{
+			newRule("mask_sequences", "[masked]", "password=\\w+"),
+			newRule("include_at_match", "", "ERROR|WARN"),
+			newRule("include_at_match", "", "user="),
+			newRule("exclude_at_match", "", "healthcheck"),
+		},
+		TagsPayload: []byte{'-'},
+	}
+
+	shouldProcess, redactedMessage = p.applyRedactingRules(newNetworkMessage([]byte("ERROR login failed user=bob password=secret"), &source))
+	assert.Equal(t, true, shouldProcess)
+	assert.Equal(t, []byte("ERROR login failed user=bob [masked]"), redactedMessage)
+
+	// all the include_at_match rules must match
+	shouldProcess, _ = p.applyRedactingRules(newNetworkMessage([]byte("ERROR login failed"), &source))
+	assert.Equal(t, false, shouldProcess)
+	shouldProcess, _ = p.applyRedactingRules(newNetworkMessage([]byte("INFO login user=bob"), &source))
+	assert.Equal(t, false, shouldProcess)
+
+	// exclusions apply to included messages
+	shouldProcess, _ = p.applyRedactingRules(newNetworkMessage([]byte("WARN healthcheck slow user=probe"), &source))
+	assert.Equal(t, false, shouldProcess)
+
+	// rules see the content masked by the previous rules
+	source.ProcessingRules = []config.LogsProcessingRule{
+		newRule("mask_sequences", "[masked]", "ERROR"),
+		newRule("include_at_match", "", "ERROR"),
+	}
+	shouldProcess, _ = p.applyRedactingRules(newNetworkMessage([]byte("ERROR login failed"), &source))
+	assert.Equal(t, false, shouldProcess)
+}
+
 func TestTruncate(t *testing.T) {
 	p := NewTestProcessor()
 	source := config.IntegrationConfigLogSource{}
@@ -138,8 +194,31 @@ func TestComputeExtraContent(t *testing.T) {
 	assert.Equal(t, "tags", extraContentParts[6])
 }
 
+func TestComputeExtraContentWithJSONFields(t *testing.T) {
+	p := NewTestProcessor()
+	source := &config.IntegrationConfigLogSource{Service: "sourceService", LogFormat: config.LOG_FORMAT_JSON, TagsPayload: []byte{'-'}}
+	msg := newNetworkMessage([]byte(`{"message":"hello","level":"error","service":"app","user":"bob"}`), source)
+	assert.Equal(t, "hello", string(parseJSON(msg, msg.Content())))
+
+	extraContentParts := strings.Split(string(p.computeExtraContent(msg)), " ")
+	assert.Equal(t, "<43>0", extraContentParts[0])
+	assert.Equal(t, "app", extraContentParts[3])
+	assert.Equal(t, `[fields`, extraContentParts[6])
+	assert.Equal(t, `user="bob"]`, extraContentParts[7])
+}
+
+func TestComputeExtraContentWithSyslogFields(t *testing.T) {
+	p := NewTestProcessor()
+	source := &config.IntegrationConfigLogSource{LogFormat: config.LOG_FORMAT_SYSLOG, TagsPayload: []byte(`[dd ddtags="env:prod"]`)}
+	msg := newNetworkMessage([]byte(`<165>1 2017-10-16T12:00:00Z router app - - [meta seq="1"] hello`), source)
+	assert.Equal(t, "hello", string(parseSyslog(msg, msg.Content())))
+
+	extraContent := string(p.computeExtraContent(msg))
+	assert.Equal(t, `<165>0 2017-10-16T12:00:00.000000000Z router app - - [dd ddtags="env:prod"][meta seq="1"] `, extraContent)
+}
+
 func TestComputeApiKeyString(t *testing.T) {
-	p := New(nil, nil, "hello", "world")
+	p := New(nil, nil, "hello", "world", NewSourceLimiters(), false)
 
 	source := &config.IntegrationConfigLogSource{}
 	extraContent := p.computeApiKeyString(newNetworkMessage(nil, source))
@@ -0,0 +1,55 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"regexp"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/DataDog/datadog-log-agent/pkg/message"
+)
+
+// severityDetectionMaxLen is the length of the beginning of the messages where levels are looked for
+const severityDetectionMaxLen = 256
+
+// levelField matches the level of structured messages: level=error, "level":"error", severity: warn
+var levelField = regexp.MustCompile(`(?i)\b(?:level|lvl|severity)"?\s*[=:]\s*"?([a-z]+)`)
+
+// levelToken matches the usual level names in upper case, like ERROR or [WARN]
+var levelToken = regexp.MustCompile(`\b(EMERG|EMERGENCY|PANIC|ALERT|CRIT|CRITICAL|FATAL|ERR|ERROR|WARN|WARNING|NOTICE|INFO|DEBUG|TRACE)\b`)
+
+// applySeverityRules sets the severity of msg to the level of the first severity rule matching content,
+// or, when its source detects severities, to the level found in content if msg has no severity yet
+func applySeverityRules(msg message.Message, content []byte) {
+	source := msg.GetOrigin().LogSource
+	for _, rule := range source.ProcessingRules {
+		if rule.Type == config.SEVERITY && rule.Reg.Match(content) {
+			msg.SetSeverity(config.SeverityFromLevel(rule.Level))
+			return
+		}
+	}
+	if source.DetectSeverity && msg.GetSeverity() == nil {
+		if severity := detectSeverity(content); severity != nil {
+			msg.SetSeverity(severity)
+		}
+	}
+}
+
+// detectSeverity returns the severity of the level field or name found at the beginning of content,
+// or nil if there is none
+func detectSeverity(content []byte) []byte {
+	if len(content) > severityDetectionMaxLen {
+		content = content[:severityDetectionMaxLen]
+	}
+	for _, reg := range []*regexp.Regexp{levelField, levelToken} {
+		if submatches := reg.FindSubmatch(content); submatches != nil {
+			if severity := config.SeverityFromLevel(string(submatches[1])); severity != nil {
+				return severity
+			}
+		}
+	}
+	return nil
+}
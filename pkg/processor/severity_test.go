@@ -0,0 +1,63 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectSeverity(t *testing.T) {
+	assert.Equal(t, config.SEV_ERROR, detectSeverity([]byte("2017-10-16 12:00:00 ERROR failed to connect")))
+	assert.Equal(t, config.SEV_WARNING, detectSeverity([]byte("[WARN] disk almost full")))
+	assert.Equal(t, config.SEV_CRITICAL, detectSeverity([]byte("FATAL: out of memory")))
+	assert.Equal(t, config.SEV_ERROR, detectSeverity([]byte(`time="2017-10-16T12:00:00Z" level=error msg="failed"`)))
+	assert.Equal(t, config.SEV_DEBUG, detectSeverity([]byte(`{"msg":"cache miss","level":"debug"}`)))
+	assert.Equal(t, config.SEV_WARNING, detectSeverity([]byte(`severity: Warning, disk almost full`)))
+
+	// the level field takes precedence over the level names
+	assert.Equal(t, config.SEV_INFO, detectSeverity([]byte(`level=info msg="ERROR count is 0"`)))
+
+	// level names in lower case are common words
+	assert.Nil(t, detectSeverity([]byte("no error found")))
+	assert.Nil(t, detectSeverity([]byte("ERRORS")))
+	assert.Nil(t, detectSeverity([]byte(strings.Repeat("a", severityDetectionMaxLen)+" ERROR")))
+}
+
+func TestApplySeverityRules(t *testing.T) {
+	rule := config.LogsProcessingRule{Type: config.SEVERITY, Name: "glog_errors", Reg: regexp.MustCompile(`^E\d{4}`), Level: "error"}
+	source := &config.IntegrationConfigLogSource{ProcessingRules: []config.LogsProcessingRule{rule}, TagsPayload: []byte{'-'}}
+
+	msg := newNetworkMessage(nil, source)
+	applySeverityRules(msg, []byte("E1016 12:00:00.000000 1 main.go:42] failed"))
+	assert.Equal(t, config.SEV_ERROR, msg.GetSeverity())
+
+	// the rules override the severity of the message
+	msg = newNetworkMessage(nil, source)
+	msg.SetSeverity(config.SEV_INFO)
+	applySeverityRules(msg, []byte("E1016 12:00:00.000000 1 main.go:42] failed"))
+	assert.Equal(t, config.SEV_ERROR, msg.GetSeverity())
+
+	// levels are detected only when enabled
+	msg = newNetworkMessage(nil, source)
+	applySeverityRules(msg, []byte("WARN disk almost full"))
+	assert.Nil(t, msg.GetSeverity())
+
+	source.DetectSeverity = true
+	msg = newNetworkMessage(nil, source)
+	applySeverityRules(msg, []byte("WARN disk almost full"))
+	assert.Equal(t, config.SEV_WARNING, msg.GetSeverity())
+
+	// detection doesn't override the severity of the message
+	msg = newNetworkMessage(nil, source)
+	msg.SetSeverity(config.SEV_ERROR)
+	applySeverityRules(msg, []byte("INFO started"))
+	assert.Equal(t, config.SEV_ERROR, msg.GetSeverity())
+}
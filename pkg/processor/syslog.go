@@ -0,0 +1,232 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/DataDog/datadog-log-agent/pkg/message"
+)
+
+// syslogMaxPRI is the highest valid priority, facility 23 and severity 7
+const syslogMaxPRI = 191
+
+// rfc3164TimestampLayout is the layout of the timestamps of RFC3164 messages, which have no year
+const rfc3164TimestampLayout = "Jan _2 15:04:05"
+
+// rfc3164TagMaxLen is the maximum length of the tag of a RFC3164 message
+const rfc3164TagMaxLen = 32
+
+// utf8BOM may start the content of a RFC5424 message
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// syslogMessage holds the fields of a syslog message, empty when missing
+type syslogMessage struct {
+	timestamp      string
+	hostname       string
+	appName        string
+	structuredData []byte
+	content        []byte
+}
+
+// parseSyslog extracts the fields of content when it's a RFC5424 or RFC3164 message:
+// PRI becomes the severity, timestamp, hostname and app-name go to the header of the message,
+// and the structured data is sent after the tags of the source.
+// The app-name is the service unless the source has one. Content that is not syslog is sent as is
+func parseSyslog(msg message.Message, content []byte) []byte {
+	pri, rest, ok := parsePRI(content)
+	if !ok {
+		return content
+	}
+	var fields syslogMessage
+	if isRFC5424(rest) {
+		if fields, ok = parseRFC5424(rest); !ok {
+			return content
+		}
+	} else {
+		fields = parseRFC3164(rest, time.Now())
+	}
+
+	msg.SetSeverity(pri)
+	if fields.timestamp != "" {
+		msg.SetTimestamp(fields.timestamp)
+	}
+	if fields.hostname != "" {
+		msg.SetHostname(fields.hostname)
+	}
+	if fields.appName != "" && msg.GetOrigin().LogSource.Service == "" {
+		msg.SetService(fields.appName)
+	}
+	if fields.structuredData != nil {
+		addTagsPayload(msg, fields.structuredData)
+	}
+	return fields.content
+}
+
+// parsePRI returns the `<PRI>` starting content and the rest of content
+func parsePRI(content []byte) ([]byte, []byte, bool) {
+	end := bytes.IndexByte(content, '>')
+	if len(content) == 0 || content[0] != '<' || end < 2 || end > 4 {
+		return nil, nil, false
+	}
+	pri, err := strconv.Atoi(string(content[1:end]))
+	if err != nil || pri < 0 || pri > syslogMaxPRI {
+		return nil, nil, false
+	}
+	return append([]byte{}, content[:end+1]...), content[end+1:], true
+}
+
+// isRFC5424 returns true if the message after its PRI starts with a protocol version
+func isRFC5424(b []byte) bool {
+	return len(b) >= 2 && b[0] >= '1' && b[0] <= '9' && b[1] == ' '
+}
+
+// parseRFC5424 parses `VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]`,
+// where "-" is a missing field. PROCID and MSGID are not kept
+func parseRFC5424(b []byte) (syslogMessage, bool) {
+	var fields syslogMessage
+	header := make([][]byte, 6)
+	for i := range header {
+		end := bytes.IndexByte(b, ' ')
+		if end <= 0 {
+			return fields, false
+		}
+		header[i], b = b[:end], b[end+1:]
+	}
+	if timestamp, err := time.Parse(time.RFC3339Nano, string(header[1])); err == nil {
+		fields.timestamp = timestamp.UTC().Format(config.DateFormat)
+	}
+	fields.hostname = nilValue(header[2])
+	fields.appName = nilValue(header[3])
+
+	sd, b, ok := splitStructuredData(b)
+	if !ok {
+		return fields, false
+	}
+	fields.structuredData = sd
+	if len(b) > 0 {
+		b = b[1:]
+	}
+	fields.content = bytes.TrimPrefix(b, utf8BOM)
+	return fields, true
+}
+
+// nilValue returns field, or "" for the nil value "-"
+func nilValue(field []byte) string {
+	if bytes.Equal(field, []byte{'-'}) {
+		return ""
+	}
+	return string(field)
+}
+
+// splitStructuredData returns the structured data elements starting b, or nil for the nil value,
+// and the rest of b which must be empty or start with a space
+func splitStructuredData(b []byte) ([]byte, []byte, bool) {
+	rest := b
+	if len(rest) > 0 && rest[0] == '-' {
+		rest = rest[1:]
+	} else {
+		for len(rest) > 0 && rest[0] == '[' {
+			end := sdElementEnd(rest)
+			if end < 0 {
+				return nil, nil, false
+			}
+			rest = rest[end+1:]
+		}
+		if len(rest) == len(b) {
+			return nil, nil, false
+		}
+	}
+	if len(rest) > 0 && rest[0] != ' ' {
+		return nil, nil, false
+	}
+	sd := b[:len(b)-len(rest)]
+	if bytes.Equal(sd, []byte{'-'}) {
+		sd = nil
+	}
+	return sd, rest, true
+}
+
+// sdElementEnd returns the index of the ']' closing the structured data element starting b,
+// or -1 if it's not closed. Values are quoted and may contain escaped '"', '\' and ']'
+func sdElementEnd(b []byte) int {
+	inValue := false
+	for i := 1; i < len(b); i++ {
+		switch {
+		case inValue && b[i] == '\\':
+			i++
+		case b[i] == '"':
+			inValue = !inValue
+		case !inValue && b[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseRFC3164 parses `TIMESTAMP HOSTNAME TAG[PID]: MSG` where the timestamp is `Mmm dd hh:mm:ss`
+// in the local time of the agent, or RFC3339 for some senders, and the hostname may be missing.
+// Without a valid timestamp, the whole message is the content
+func parseRFC3164(b []byte, now time.Time) syslogMessage {
+	fields := syslogMessage{content: b}
+	var rest []byte
+	if len(b) > len(rfc3164TimestampLayout) && b[len(rfc3164TimestampLayout)] == ' ' {
+		if timestamp, err := parseRFC3164Timestamp(string(b[:len(rfc3164TimestampLayout)]), now); err == nil {
+			fields.timestamp = timestamp.UTC().Format(config.DateFormat)
+			rest = b[len(rfc3164TimestampLayout)+1:]
+		}
+	}
+	if rest == nil {
+		end := bytes.IndexByte(b, ' ')
+		if end <= 0 {
+			return fields
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, string(b[:end]))
+		if err != nil {
+			return fields
+		}
+		fields.timestamp = timestamp.UTC().Format(config.DateFormat)
+		rest = b[end+1:]
+	}
+	fields.content = rest
+
+	// the hostname is followed by the tag, which ends with ':' or '['
+	if end := bytes.IndexByte(rest, ' '); end > 0 && bytes.IndexAny(rest[:end], ":[") < 0 {
+		fields.hostname = string(rest[:end])
+		rest = rest[end+1:]
+		fields.content = rest
+	}
+	if end := bytes.IndexAny(rest, ":[ "); end > 0 && end <= rfc3164TagMaxLen && rest[end] != ' ' {
+		tag := rest[:end]
+		if rest[end] == '[' {
+			closing := bytes.IndexByte(rest, ']')
+			if closing < 0 || closing+1 >= len(rest) || rest[closing+1] != ':' {
+				return fields
+			}
+			end = closing + 1
+		}
+		fields.appName = string(tag)
+		fields.content = bytes.TrimPrefix(rest[end+1:], []byte{' '})
+	}
+	return fields
+}
+
+// parseRFC3164Timestamp returns the timestamp in the year of now unless it would be
+// more than a month ahead: a message from December received in January is from the previous year
+func parseRFC3164Timestamp(value string, now time.Time) (time.Time, error) {
+	t, err := time.ParseInLocation(rfc3164TimestampLayout, value, time.Local)
+	if err != nil {
+		return t, err
+	}
+	t = t.AddDate(now.Year()-t.Year(), 0, 0)
+	if t.After(now.AddDate(0, 1, 0)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, nil
+}
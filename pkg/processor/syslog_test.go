@@ -0,0 +1,105 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSyslogRFC5424(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{LogFormat: config.LOG_FORMAT_SYSLOG, TagsPayload: []byte(`[dd ddtags="env:prod"]`)}
+	msg := newNetworkMessage(nil, source)
+	content := parseSyslog(msg, []byte(`<165>1 2017-10-16T12:00:00.5+02:00 router.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="App\]lication"][meta seq="1"] `+"\xef\xbb\xbf"+`An application event`))
+	assert.Equal(t, "An application event", string(content))
+	assert.Equal(t, "<165>", string(msg.GetSeverity()))
+	assert.Equal(t, "2017-10-16T10:00:00.500000000Z", msg.GetTimestamp())
+	assert.Equal(t, "router.example.com", msg.GetHostname())
+	assert.Equal(t, "evntslog", msg.GetService())
+	assert.Equal(t, `[dd ddtags="env:prod"][exampleSDID@32473 iut="3" eventSource="App\]lication"][meta seq="1"]`, string(msg.GetTagsPayload()))
+	assert.Equal(t, `[dd ddtags="env:prod"]`, string(source.TagsPayload))
+}
+
+func TestParseSyslogRFC5424WithNilValues(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{Service: "sourceService", LogFormat: config.LOG_FORMAT_SYSLOG, TagsPayload: []byte{'-'}}
+	msg := newNetworkMessage(nil, source)
+	content := parseSyslog(msg, []byte(`<13>1 - - app - - -`))
+	assert.Equal(t, "", string(content))
+	assert.Equal(t, "<13>", string(msg.GetSeverity()))
+	assert.Equal(t, "", msg.GetTimestamp())
+	assert.Equal(t, "", msg.GetHostname())
+	assert.Equal(t, "sourceService", msg.GetService())
+	assert.Equal(t, "-", string(msg.GetTagsPayload()))
+}
+
+func TestParseSyslogRFC3164(t *testing.T) {
+	now := time.Date(2017, time.October, 16, 12, 0, 0, 0, time.Local)
+	fields := parseRFC3164([]byte("Oct  6 08:30:00 switch1 sshd[1234]: Accepted publickey for bob"), now)
+	assert.Equal(t, time.Date(2017, time.October, 6, 8, 30, 0, 0, time.Local).UTC().Format(config.DateFormat), fields.timestamp)
+	assert.Equal(t, "switch1", fields.hostname)
+	assert.Equal(t, "sshd", fields.appName)
+	assert.Equal(t, "Accepted publickey for bob", string(fields.content))
+
+	// without hostname
+	fields = parseRFC3164([]byte("Oct 16 11:00:00 kernel: link down"), now)
+	assert.Equal(t, "", fields.hostname)
+	assert.Equal(t, "kernel", fields.appName)
+	assert.Equal(t, "link down", string(fields.content))
+
+	// without tag
+	fields = parseRFC3164([]byte("Oct 16 11:00:00 switch1 link down"), now)
+	assert.Equal(t, "switch1", fields.hostname)
+	assert.Equal(t, "", fields.appName)
+	assert.Equal(t, "link down", string(fields.content))
+
+	// RFC3339 timestamp
+	fields = parseRFC3164([]byte("2017-10-16T12:00:00+02:00 switch1 app: hello"), now)
+	assert.Equal(t, "2017-10-16T10:00:00.000000000Z", fields.timestamp)
+	assert.Equal(t, "switch1", fields.hostname)
+	assert.Equal(t, "app", fields.appName)
+	assert.Equal(t, "hello", string(fields.content))
+
+	// without timestamp
+	fields = parseRFC3164([]byte("switch1 app: hello"), now)
+	assert.Equal(t, "", fields.timestamp)
+	assert.Equal(t, "", fields.hostname)
+	assert.Equal(t, "switch1 app: hello", string(fields.content))
+}
+
+func TestParseRFC3164TimestampYear(t *testing.T) {
+	now := time.Date(2018, time.January, 1, 0, 10, 0, 0, time.Local)
+	timestamp, err := parseRFC3164Timestamp("Dec 31 23:59:00", now)
+	assert.Nil(t, err)
+	assert.True(t, time.Date(2017, time.December, 31, 23, 59, 0, 0, time.Local).Equal(timestamp))
+
+	timestamp, err = parseRFC3164Timestamp("Jan  1 00:05:00", now)
+	assert.Nil(t, err)
+	assert.True(t, time.Date(2018, time.January, 1, 0, 5, 0, 0, time.Local).Equal(timestamp))
+}
+
+func TestParseSyslogSetsSeverityAndHostname(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{LogFormat: config.LOG_FORMAT_SYSLOG, TagsPayload: []byte{'-'}}
+	msg := newNetworkMessage(nil, source)
+	content := parseSyslog(msg, []byte("<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8"))
+	assert.Equal(t, "'su root' failed for lonvick on /dev/pts/8", string(content))
+	assert.Equal(t, "<34>", string(msg.GetSeverity()))
+	assert.Equal(t, "mymachine", msg.GetHostname())
+	assert.Equal(t, "su", msg.GetService())
+	assert.Equal(t, "-", string(msg.GetTagsPayload()))
+}
+
+func TestParseMalformedSyslog(t *testing.T) {
+	source := &config.IntegrationConfigLogSource{LogFormat: config.LOG_FORMAT_SYSLOG, TagsPayload: []byte{'-'}}
+	for _, content := range []string{"hello", "<192>1 - - - - - -", "<abc>hello", "<13>1 - - - - - [unclosed", "<13>1 - - -"} {
+		msg := newNetworkMessage(nil, source)
+		assert.Equal(t, content, string(parseSyslog(msg, []byte(content))))
+		assert.Nil(t, msg.GetSeverity())
+		assert.Equal(t, "", msg.GetHostname())
+	}
+}
@@ -0,0 +1,168 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/DataDog/datadog-log-agent/pkg/message"
+)
+
+// timestampMaxFuture is how far in the future a timestamp can be, later timestamps are ignored
+const timestampMaxFuture = time.Hour
+
+// timestampGroup is the name of the group capturing the timestamp in the pattern of a timestamp rule,
+// the first group captures it when there is none
+const timestampGroup = "timestamp"
+
+// commonLogLayout is the layout of the timestamps of the common log format
+const commonLogLayout = "02/Jan/2006:15:04:05 -0700"
+
+// applyTimestampRules sets the timestamp of msg to the timestamp captured by the first timestamp rule
+// matching content. When no rule matches, the timestamp is the one of the source or the ingestion time,
+// or the timestamp of the previous message of its origin in previousTimestamps with the previous fallback
+func applyTimestampRules(msg message.Message, content []byte, now time.Time, previousTimestamps *sourceTimestamps) {
+	source := msg.GetOrigin().LogSource
+	key := originKey{source: source, identifier: msg.GetOrigin().Identifier}
+	hasRules := false
+	for _, rule := range source.ProcessingRules {
+		if rule.Type != config.TIMESTAMP {
+			continue
+		}
+		hasRules = true
+		if timestamp, ok := extractTimestamp(rule, content, now); ok {
+			msg.SetTimestamp(timestamp)
+			if source.TimestampFallback == config.TIMESTAMP_FALLBACK_PREVIOUS {
+				previousTimestamps.set(key, timestamp, now)
+			}
+			return
+		}
+	}
+	if hasRules && source.TimestampFallback == config.TIMESTAMP_FALLBACK_PREVIOUS {
+		if timestamp := previousTimestamps.get(key); timestamp != "" {
+			msg.SetTimestamp(timestamp)
+		}
+	}
+}
+
+// extractTimestamp returns the timestamp captured by rule in content formatted as config.DateFormat,
+// unless it's invalid or more than timestampMaxFuture ahead of now
+func extractTimestamp(rule config.LogsProcessingRule, content []byte, now time.Time) (string, bool) {
+	submatches := rule.Reg.FindSubmatch(content)
+	if submatches == nil {
+		return "", false
+	}
+	value := submatches[0]
+	if len(submatches) > 1 {
+		value = submatches[1]
+	}
+	for i, name := range rule.Reg.SubexpNames() {
+		if name == timestampGroup {
+			value = submatches[i]
+		}
+	}
+	timestamp, err := parseTimestamp(string(value), rule.Layout, now)
+	if err != nil {
+		return "", false
+	}
+	if timestamp.After(now.Add(timestampMaxFuture)) {
+		processorExpvars.Add("FutureTimestamps", 1)
+		return "", false
+	}
+	return timestamp.UTC().Format(config.DateFormat), true
+}
+
+// parseTimestamp parses value with layout, a named layout or a go layout.
+// Timestamps without time zone are in the local time of the agent
+func parseTimestamp(value, layout string, now time.Time) (time.Time, error) {
+	switch layout {
+	case config.TIMESTAMP_LAYOUT_UNIX, config.TIMESTAMP_LAYOUT_UNIX_MS:
+		unit := time.Second
+		if layout == config.TIMESTAMP_LAYOUT_UNIX_MS {
+			unit = time.Millisecond
+		}
+		return parseEpoch(value, unit)
+	case config.TIMESTAMP_LAYOUT_RFC3339:
+		return time.Parse(time.RFC3339Nano, value)
+	case config.TIMESTAMP_LAYOUT_COMMON_LOG:
+		return time.Parse(commonLogLayout, value)
+	case config.TIMESTAMP_LAYOUT_SYSLOG:
+		return parseRFC3164Timestamp(value, now)
+	default:
+		return time.ParseInLocation(layout, value, time.Local)
+	}
+}
+
+// parseEpoch parses an epoch in unit, with an optional decimal part
+// parsed as an integer to avoid floating point rounding
+func parseEpoch(value string, unit time.Duration) (time.Time, error) {
+	integer, decimals := value, ""
+	if dot := strings.IndexByte(value, '.'); dot >= 0 {
+		integer, decimals = value[:dot], value[dot+1:]
+	}
+	epoch, err := strconv.ParseInt(integer, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nanoseconds := epoch * int64(unit)
+	if decimals != "" {
+		// the number of decimal digits of a nanosecond in unit
+		digits := len(strconv.FormatInt(int64(unit), 10)) - 1
+		if len(decimals) > digits {
+			decimals = decimals[:digits]
+		}
+		decimals += strings.Repeat("0", digits-len(decimals))
+		fraction, err := strconv.ParseUint(decimals, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		nanoseconds += int64(fraction)
+	}
+	return time.Unix(0, nanoseconds), nil
+}
+
+// sourceTimestamp is the last timestamp of an origin
+type sourceTimestamp struct {
+	timestamp string
+	lastSeen  time.Time
+}
+
+// sourceTimestamps holds the last timestamp of the origins.
+// Each processor has its own, the messages of an origin going through a single pipeline
+type sourceTimestamps struct {
+	timestamps map[originKey]sourceTimestamp
+	lastSweep  time.Time
+}
+
+// newSourceTimestamps returns a new sourceTimestamps
+func newSourceTimestamps() *sourceTimestamps {
+	return &sourceTimestamps{
+		timestamps: make(map[originKey]sourceTimestamp),
+	}
+}
+
+// get returns the last timestamp of the origin, or "" if there is none
+func (s *sourceTimestamps) get(key originKey) string {
+	return s.timestamps[key].timestamp
+}
+
+// set sets the last timestamp of the origin, and removes the timestamps of the origins
+// idle since sourceIdleTimeout
+func (s *sourceTimestamps) set(key originKey, timestamp string, now time.Time) {
+	s.timestamps[key] = sourceTimestamp{timestamp: timestamp, lastSeen: now}
+	if now.Sub(s.lastSweep) < sourceIdleTimeout {
+		return
+	}
+	s.lastSweep = now
+	for key, last := range s.timestamps {
+		if now.Sub(last.lastSeen) > sourceIdleTimeout {
+			delete(s.timestamps, key)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Unless explicitly stated otherwise all files in this repository are licensed
+// under the Apache License Version 2.0.
+// This product includes software developed at Datadog (https://www.datadoghq.com/).
+// Copyright 2017 Datadog, Inc.
+
+package processor
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-log-agent/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTimestampRule(pattern, layout string) config.LogsProcessingRule {
+	return config.LogsProcessingRule{Type: config.TIMESTAMP, Name: "timestamp", Reg: regexp.MustCompile(pattern), Layout: layout}
+}
+
+func TestExtractTimestamp(t *testing.T) {
+	now := time.Date(2017, time.October, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule     config.LogsProcessingRule
+		content  string
+		expected string
+	}{
+		{newTimestampRule(`^(\d+)`, config.TIMESTAMP_LAYOUT_UNIX), "1508148000 started", "2017-10-16T10:00:00.000000000Z"},
+		{newTimestampRule(`^(\S+)`, config.TIMESTAMP_LAYOUT_UNIX), "1508148000.25 started", "2017-10-16T10:00:00.250000000Z"},
+		{newTimestampRule(`ts=(\d+)`, config.TIMESTAMP_LAYOUT_UNIX_MS), "msg=started ts=1508148000123", "2017-10-16T10:00:00.123000000Z"},
+		{newTimestampRule(`ts=(\S+)`, config.TIMESTAMP_LAYOUT_UNIX_MS), "msg=started ts=1508148000123.4567", "2017-10-16T10:00:00.123456700Z"},
+		{newTimestampRule(`^(\S+)`, config.TIMESTAMP_LAYOUT_UNIX), "1508148000.1234567891 started", "2017-10-16T10:00:00.123456789Z"},
+		{newTimestampRule(`^\[(\S+)\]`, config.TIMESTAMP_LAYOUT_RFC3339), "[2017-10-16T12:00:00.5+02:00] started", "2017-10-16T10:00:00.500000000Z"},
+		{newTimestampRule(`\[(?P<timestamp>[^\]]+)\]`, config.TIMESTAMP_LAYOUT_COMMON_LOG), `127.0.0.1 - - [16/Oct/2017:12:00:00 +0200] "GET / HTTP/1.1" 200`, "2017-10-16T10:00:00.000000000Z"},
+		{newTimestampRule(`^(\w+) (?P<timestamp>\d{4}-\d{2}-\d{2}T\S+)`, config.TIMESTAMP_LAYOUT_RFC3339), "INFO 2017-10-16T10:00:00Z started", "2017-10-16T10:00:00.000000000Z"},
+		{newTimestampRule(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} [+-]\d{4}`, "2006-01-02 15:04:05 -0700"), "2017-10-16 12:00:00 +0200 started", "2017-10-16T10:00:00.000000000Z"},
+	}
+	for _, test := range tests {
+		timestamp, ok := extractTimestamp(test.rule, []byte(test.content), now)
+		assert.True(t, ok, test.content)
+		assert.Equal(t, test.expected, timestamp, test.content)
+	}
+
+	// the local time of the agent is used without time zone
+	timestamp, ok := extractTimestamp(newTimestampRule(`^(\S+ \S+)`, "2006-01-02 15:04:05"), []byte("2017-10-16 08:00:00 started"), now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2017, time.October, 16, 8, 0, 0, 0, time.Local).UTC().Format(config.DateFormat), timestamp)
+	timestamp, ok = extractTimestamp(newTimestampRule(`^(\w+ +\d+ \S+)`, config.TIMESTAMP_LAYOUT_SYSLOG), []byte("Oct 16 08:00:00 started"), now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2017, time.October, 16, 8, 0, 0, 0, time.Local).UTC().Format(config.DateFormat), timestamp)
+
+	_, ok = extractTimestamp(newTimestampRule(`^(\d+)`, config.TIMESTAMP_LAYOUT_UNIX), []byte("started"), now)
+	assert.False(t, ok)
+	_, ok = extractTimestamp(newTimestampRule(`^(\S+)`, config.TIMESTAMP_LAYOUT_RFC3339), []byte("yesterday started"), now)
+	assert.False(t, ok)
+}
+
+func TestExtractTimestampInTheFuture(t *testing.T) {
+	now := time.Date(2017, time.October, 16, 12, 0, 0, 0, time.UTC)
+	rule := newTimestampRule(`^(\S+)`, config.TIMESTAMP_LAYOUT_RFC3339)
+	_, ok := extractTimestamp(rule, []byte("2017-10-16T12:59:00Z started"), now)
+	assert.True(t, ok)
+	_, ok = extractTimestamp(rule, []byte("2017-10-16T13:01:00Z started"), now)
+	assert.False(t, ok)
+}
+
+func TestApplyTimestampRules(t *testing.T) {
+	now := time.Date(2017, time.October, 16, 12, 0, 0, 0, time.UTC)
+	rules := []config.LogsProcessingRule{
+		newTimestampRule(`^(\d{4}-\S+)`, config.TIMESTAMP_LAYOUT_RFC3339),
+		newTimestampRule(`^(\d+) `, config.TIMESTAMP_LAYOUT_UNIX),
+	}
+	source := &config.IntegrationConfigLogSource{ProcessingRules: rules, TagsPayload: []byte{'-'}}
+	previousTimestamps := newSourceTimestamps()
+
+	// the first rule matching sets the timestamp
+	msg := newNetworkMessage(nil, source)
+	applyTimestampRules(msg, []byte("1508148000 started"), now, previousTimestamps)
+	assert.Equal(t, "2017-10-16T10:00:00.000000000Z", msg.GetTimestamp())
+
+	// the timestamp of the origin is kept when no rule matches
+	msg = newNetworkMessage(nil, source)
+	msg.GetOrigin().Timestamp = "2017-10-16T11:00:00.000000000Z"
+	applyTimestampRules(msg, []byte("  at main.go:42"), now, previousTimestamps)
+	assert.Equal(t, "2017-10-16T11:00:00.000000000Z", msg.GetTimestamp())
+
+	// or the timestamp of the previous message of the source is used
+	source.TimestampFallback = config.TIMESTAMP_FALLBACK_PREVIOUS
+	msg = newNetworkMessage(nil, source)
+	applyTimestampRules(msg, []byte("  at main.go:42"), now, previousTimestamps)
+	assert.Equal(t, "", msg.GetTimestamp())
+	msg = newNetworkMessage(nil, source)
+	applyTimestampRules(msg, []byte("2017-10-16T09:00:00Z panic"), now, previousTimestamps)
+	assert.Equal(t, "2017-10-16T09:00:00.000000000Z", msg.GetTimestamp())
+	msg = newNetworkMessage(nil, source)
+	applyTimestampRules(msg, []byte("  at main.go:42"), now, previousTimestamps)
+	assert.Equal(t, "2017-10-16T09:00:00.000000000Z", msg.GetTimestamp())
+
+	// of the previous message of the same origin
+	msg = newNetworkMessage(nil, source)
+	msg.GetOrigin().Identifier = "file:/var/log/other.log"
+	applyTimestampRules(msg, []byte("  at main.go:42"), now, previousTimestamps)
+	assert.Equal(t, "", msg.GetTimestamp())
+}
+
+func TestSourceTimestampsRemovesIdleOrigins(t *testing.T) {
+	now := time.Now()
+	source := &config.IntegrationConfigLogSource{}
+	idle := originKey{source: source, identifier: "file:/var/log/idle.log"}
+	active := originKey{source: source, identifier: "file:/var/log/active.log"}
+	s := newSourceTimestamps()
+	s.set(idle, "2017-10-16T09:00:00.000000000Z", now)
+	s.set(active, "2017-10-16T09:00:00.000000000Z", now.Add(sourceIdleTimeout))
+	assert.Equal(t, 2, len(s.timestamps))
+	s.set(active, "2017-10-16T10:00:00.000000000Z", now.Add(2*sourceIdleTimeout))
+	assert.Equal(t, "", s.get(idle))
+	assert.Equal(t, "2017-10-16T10:00:00.000000000Z", s.get(active))
+}